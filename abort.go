@@ -0,0 +1,16 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import "net/http"
+
+// isAbort reports whether the recovered value aborts the response on purpose,
+// see RecovererJSON.
+func isAbort(rcv interface{}) bool {
+	return rcv == http.ErrAbortHandler
+}
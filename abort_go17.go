@@ -0,0 +1,14 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build !go1.8
+// +build !go1.8
+
+package httprouter
+
+// isAbort always reports false before Go 1.8, which added
+// http.ErrAbortHandler.
+func isAbort(rcv interface{}) bool {
+	return false
+}
@@ -0,0 +1,26 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovererJSONAbortHandler(t *testing.T) {
+	handle := RecovererJSON()(func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic(http.ErrAbortHandler)
+	})
+	recv := catchPanic(func() {
+		handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	})
+	if recv != http.ErrAbortHandler {
+		t.Errorf("want ErrAbortHandler to be re-panicked, got %v", recv)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// loadGithubAPI returns a router with all routes of the GitHub API and the
+// requests for them. The handles record the matched route in *routed.
+func loadGithubAPI(routed *string) (*Router, []*http.Request) {
+	router := New()
+	routes := GithubAPIRoutes(nil)
+	reqs := make([]*http.Request, len(routes))
+	for i, route := range routes {
+		path := route.Path
+		router.Handle(route.Method, path, func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			if routed != nil {
+				*routed = path
+			}
+		})
+		reqs[i] = httptest.NewRequest(route.Method, SamplePath(path), nil)
+	}
+	return router, reqs
+}
+
+func TestRouterGithubAPI(t *testing.T) {
+	var routed string
+	router, reqs := loadGithubAPI(&routed)
+
+	for i, r := range reqs {
+		routed = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if want := githubAPI[i].path; routed != want {
+			t.Errorf("%s %s: want route %s, got %q (status %d)", r.Method, r.RequestURI, want, routed, w.Code)
+		}
+	}
+}
+
+func BenchmarkLargeAPI(b *testing.B) {
+	router, reqs := loadGithubAPI(nil)
+	w := new(mockResponseWriter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range reqs {
+			router.ServeHTTP(w, r)
+		}
+	}
+}
+
+func BenchmarkLargeAPIInsert(b *testing.B) {
+	routes := GithubAPIRoutes(func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New().Register(routes)
+	}
+}
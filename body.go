@@ -0,0 +1,82 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io"
+	"net/http"
+)
+
+// MaxBodyBytes returns middleware which limits the size of request bodies to
+// n bytes, see Router.Use.
+// Requests whose Content-Length exceeds the limit are answered with status code
+// 413 right away. Otherwise the body is wrapped with http.MaxBytesReader, so
+// reading more than n bytes fails. Since the overflow only surfaces when the
+// handle reads the body, the handle should abort on read errors without
+// writing a response: the middleware then replies with 413.
+//
+//	router.Use(httprouter.MaxBodyBytes(1 << 20))
+//	router.POST("/upload", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+//		data, err := ioutil.ReadAll(r.Body)
+//		if err != nil {
+//			return // 413 is sent by MaxBodyBytes
+//		}
+//		...
+//	})
+func MaxBodyBytes(n int64) func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			limitBody(w, req, n, func(w http.ResponseWriter, req *http.Request) {
+				next(w, req, ps)
+			})
+		}
+	}
+}
+
+// limitBody serves the request with the body limited to n bytes and replies
+// with 413 if the limit was exceeded and no response was written.
+func limitBody(w http.ResponseWriter, req *http.Request, n int64, serve func(http.ResponseWriter, *http.Request)) {
+	if req.ContentLength > n {
+		http.Error(w,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge,
+		)
+		return
+	}
+	if isNoBody(req.Body) {
+		serve(w, req)
+		return
+	}
+
+	sw := &statusWriter{ResponseWriter: w}
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(sw, req.Body, n), n: n}
+	r2 := *req
+	r2.Body = body
+	serve(sw, &r2)
+
+	if body.exceeded && sw.status == 0 {
+		http.Error(w,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge,
+		)
+	}
+}
+
+// limitedBody records whether more than n bytes were read from the body.
+type limitedBody struct {
+	io.ReadCloser
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.n {
+		b.exceeded = true
+	}
+	return n, err
+}
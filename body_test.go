@@ -0,0 +1,68 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	var read string
+	handle := func(w http.ResponseWriter, r *http.Request, _ Params) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		read = string(data)
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	router := New()
+	router.POST("/upload", handle)
+	router.Use(MaxBodyBytes(8))
+
+	tests := []struct {
+		body          string
+		contentLength bool
+		code          int
+	}{
+		{"small", true, http.StatusCreated},
+		{"exactly8", false, http.StatusCreated},
+		{"this body is too large", true, http.StatusRequestEntityTooLarge},
+		{"this body is too large", false, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		read = ""
+		r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(test.body))
+		if !test.contentLength {
+			// unknown length, the overflow surfaces when the body is read
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("body %q: want status %d, got %d", test.body, test.code, w.Code)
+		}
+		if test.code == http.StatusCreated && read != test.body {
+			t.Errorf("body %q: handle read %q", test.body, read)
+		}
+	}
+
+	// limit set on the router
+	router = New()
+	router.POST("/upload", handle)
+	router.MaxBodyBytes = 8
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("this body is too large"))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want status 413, got %d", w.Code)
+	}
+}
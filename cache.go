@@ -0,0 +1,155 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "sync"
+
+// resolveCache caches the result of tree lookups by method and request path,
+// as well as the methods allowed for a request path.
+// The zero value is an empty cache ready to use.
+type resolveCache struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]*resolveEntry
+	allow   map[string]map[string]string
+	n       int
+}
+
+// resolveEntry is a cached lookup result. Instead of the param values, only
+// their positions in the request path are cached, from which the values are
+// extracted per request.
+type resolveEntry struct {
+	leaf   *node
+	params []paramPosition
+}
+
+type paramPosition struct {
+	key        string
+	start, end int
+}
+
+func (c *resolveCache) get(method, path string) *resolveEntry {
+	c.mu.RLock()
+	e := c.entries[method][path]
+	c.mu.RUnlock()
+	return e
+}
+
+// put adds an entry for the leaf matched for the path. If the cache holds
+// size entries already, it is cleared first.
+func (c *resolveCache) put(method, path string, leaf *node, size int) {
+	e := &resolveEntry{
+		leaf:   leaf,
+		params: paramPositions(leaf.fullPath, path),
+	}
+
+	c.mu.Lock()
+	if c.n >= size {
+		c.entries = nil
+		c.allow = nil
+		c.n = 0
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]map[string]*resolveEntry)
+	}
+	paths := c.entries[method]
+	if paths == nil {
+		paths = make(map[string]*resolveEntry)
+		c.entries[method] = paths
+	}
+	if _, ok := paths[path]; !ok {
+		c.n++
+	}
+	paths[path] = e
+	c.mu.Unlock()
+}
+
+// getAllow returns the cached Allow header value for requests with the method
+// and path, and whether it was cached.
+func (c *resolveCache) getAllow(method, path string) (string, bool) {
+	c.mu.RLock()
+	allow, ok := c.allow[method][path]
+	c.mu.RUnlock()
+	return allow, ok
+}
+
+// putAllow adds the Allow header value for requests with the method and path.
+// If the cache holds size entries already, it is cleared first.
+func (c *resolveCache) putAllow(method, path, allow string, size int) {
+	c.mu.Lock()
+	if c.n >= size {
+		c.entries = nil
+		c.allow = nil
+		c.n = 0
+	}
+	if c.allow == nil {
+		c.allow = make(map[string]map[string]string)
+	}
+	paths := c.allow[method]
+	if paths == nil {
+		paths = make(map[string]string)
+		c.allow[method] = paths
+	}
+	if _, ok := paths[path]; !ok {
+		c.n++
+	}
+	paths[path] = allow
+	c.mu.Unlock()
+}
+
+// reset removes all entries, e.g. because the tree was modified.
+func (c *resolveCache) reset() {
+	c.mu.Lock()
+	c.entries = nil
+	c.allow = nil
+	c.n = 0
+	c.mu.Unlock()
+}
+
+// paramPositions returns the positions of the param values in the path, which
+// must be matched by the route pattern.
+func paramPositions(pattern, path string) []paramPosition {
+	var positions []paramPosition
+	i, j := 0, 0
+	for i < len(pattern) && j <= len(path) {
+		switch pattern[i] {
+		case ':':
+			end := i + 1
+			for end < len(pattern) && pattern[end] != '/' {
+				end++
+			}
+			valueEnd := j
+			for valueEnd < len(path) && path[valueEnd] != '/' {
+				valueEnd++
+			}
+			if key := pattern[i+1 : end]; key != blankParam {
+				positions = append(positions, paramPosition{key, j, valueEnd})
+			}
+			i, j = end, valueEnd
+
+		case '*':
+			// The value of a catch-all parameter includes the preceding '/'
+			positions = append(positions, paramPosition{pattern[i+1:], j - 1, len(path)})
+			return positions
+
+		default:
+			i++
+			j++
+		}
+	}
+	return positions
+}
+
+// fill extracts the param values from the path.
+func (e *resolveEntry) fill(path string, params func() *Params, plusAsSpace bool) *Params {
+	if len(e.params) == 0 {
+		return nil
+	}
+	ps := params()
+	for _, p := range e.params {
+		value, _ := pathUnescape(path[p.start:p.end], plusAsSpace)
+		*ps = append(*ps, Param{Key: p.key, Value: value})
+	}
+	return ps
+}
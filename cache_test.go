@@ -0,0 +1,172 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterResolveCache(t *testing.T) {
+	var got Params
+	var pattern string
+	handle := func(p string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			got = append(Params(nil), ps...)
+			pattern = p
+		}
+	}
+
+	routes := []string{
+		"/",
+		"/user/:name",
+		"/user/:name/posts/:id",
+		"/user_:name/x",
+		"/src/*filepath",
+	}
+	paths := []string{
+		"/",
+		"/user/gopher",
+		"/user/go%2Fpher",
+		"/user/gopher/posts/42",
+		"/user_gopher/x",
+		"/src/",
+		"/src/some/file.go",
+		"/src/some/fi%20le.go",
+	}
+
+	uncached, cached := New(), New()
+	cached.ResolveCacheSize = 3
+	for _, route := range routes {
+		uncached.GET(route, handle(route))
+		cached.GET(route, handle(route))
+	}
+
+	// twice, to serve from the cache the second time
+	for i := 0; i < 2; i++ {
+		for _, path := range paths {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			uncached.ServeHTTP(httptest.NewRecorder(), r)
+			wantParams, wantPattern := got, pattern
+
+			got, pattern = nil, ""
+			r = httptest.NewRequest(http.MethodGet, path, nil)
+			cached.ServeHTTP(httptest.NewRecorder(), r)
+			if !reflect.DeepEqual(got, wantParams) || pattern != wantPattern {
+				t.Errorf("%s: cached resolution differs: want %s %v, got %s %v", path, wantPattern, wantParams, pattern, got)
+			}
+		}
+	}
+
+	if cached.cache.n > cached.ResolveCacheSize {
+		t.Errorf("cache exceeds its size: %d entries", cached.cache.n)
+	}
+
+	// registering a route invalidates the cache
+	cached.GET("/user/:name/x", handle("/user/:name/x"))
+	if cached.cache.n != 0 {
+		t.Errorf("cache not invalidated")
+	}
+	r := httptest.NewRequest(http.MethodGet, "/user/gopher", nil)
+	cached.ServeHTTP(httptest.NewRecorder(), r)
+	if pattern != "/user/:name" || got.ByName("name") != "gopher" {
+		t.Errorf("wrong resolution after invalidation: %s %v", pattern, got)
+	}
+}
+
+func TestRouterAllowCache(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.ResolveCacheSize = 16
+	router.GET("/user/:name", handle)
+	router.POST("/user/:name", handle)
+
+	options := func() string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/user/gopher", nil))
+		return w.Header().Get("Allow")
+	}
+
+	// twice, to serve from the cache the second time
+	for i := 0; i < 2; i++ {
+		if allow := options(); allow != "GET, OPTIONS, POST" {
+			t.Errorf("wrong Allow header: %q", allow)
+		}
+	}
+	if _, ok := router.cache.getAllow(http.MethodOptions, "/user/gopher"); !ok {
+		t.Error("Allow header not cached")
+	}
+
+	// adding a method invalidates the cached Allow header
+	router.DELETE("/user/:name", handle)
+	if allow := options(); allow != "DELETE, GET, OPTIONS, POST" {
+		t.Errorf("wrong Allow header after adding a method: %q", allow)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/user/gopher", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want status 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, OPTIONS, POST" {
+		t.Errorf("wrong Allow header of 405 response: %q", allow)
+	}
+}
+
+func benchmarkAllowCache(b *testing.B, size int) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.ResolveCacheSize = size
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		router.Handle(method, "/rpc/v1/users/:id", handle)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = router.allowed("/rpc/v1/users/42", http.MethodOptions)
+	}
+}
+
+func BenchmarkAllowedComputed(b *testing.B) {
+	benchmarkAllowCache(b, 0)
+}
+
+func BenchmarkAllowedCached(b *testing.B) {
+	benchmarkAllowCache(b, 16)
+}
+
+func benchmarkResolveCache(b *testing.B, size int) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.ResolveCacheSize = size
+	router.GET("/rpc/v1/users/:id/profile", handle)
+	router.GET("/rpc/v1/users/:id/settings", handle)
+	router.GET("/rpc/v1/orders/:id/items/:item", handle)
+	router.GET("/rpc/v1/orders/:id", handle)
+	router.GET("/rpc/v2/health", handle)
+
+	r := httptest.NewRequest(http.MethodGet, "/rpc/v1/orders/123/items/456", nil)
+	w := new(mockResponseWriter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkResolveUncached(b *testing.B) {
+	benchmarkResolveCache(b, 0)
+}
+
+func BenchmarkResolveCached(b *testing.B) {
+	benchmarkResolveCache(b, 16)
+}
@@ -0,0 +1,101 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORS configures Cross-Origin Resource Sharing, see Router.CORS.
+type CORS struct {
+	// Origins which are allowed to make cross-origin requests.
+	// "*" allows any origin. Origins only matched by "*" are answered with
+	// the literal "*" and never with credentials.
+	AllowedOrigins []string
+
+	// Request headers which are allowed in cross-origin requests.
+	// If empty, the headers requested in a preflight request are allowed.
+	AllowedHeaders []string
+
+	// Response headers which are exposed to the client.
+	ExposedHeaders []string
+
+	// Whether the request may include credentials like cookies.
+	// It only applies to origins listed explicitly in AllowedOrigins.
+	AllowCredentials bool
+
+	// How long, in seconds, the result of a preflight request may be cached.
+	// A value of 0 omits the Access-Control-Max-Age header.
+	MaxAge int
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// the origin, which is empty if the origin is not allowed.
+func (c *CORS) allowOrigin(origin string) string {
+	allow := ""
+	for _, o := range c.AllowedOrigins {
+		if o == origin {
+			return origin
+		}
+		if o == "*" {
+			allow = "*"
+		}
+	}
+	return allow
+}
+
+// setOriginHeaders sets the headers for a cross-origin request from an allowed
+// origin. It reports whether the origin is allowed.
+func (c *CORS) setOriginHeaders(w http.ResponseWriter, req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	allow := c.allowOrigin(origin)
+	if allow == "" {
+		return false
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Allow-Origin", allow)
+	// Reflecting any origin with credentials would allow every site to make
+	// credentialed requests
+	if c.AllowCredentials && allow != "*" {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(c.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+	return true
+}
+
+// servePreflight answers a preflight request for a path which allows the given
+// methods. The Allow header is set along with the CORS headers.
+func (c *CORS) servePreflight(w http.ResponseWriter, req *http.Request, allow string) {
+	h := w.Header()
+	h.Set("Allow", allow)
+	if c.setOriginHeaders(w, req) {
+		h.Set("Access-Control-Allow-Methods", allow)
+		if len(c.AllowedHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		} else if reqHeaders := req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isPreflight reports whether the request is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
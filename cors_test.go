@@ -0,0 +1,130 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterCORS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var globalOPTIONS bool
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.POST("/path", handlerFunc)
+	router.CORS = &CORS{
+		AllowedOrigins: []string{"https://example.com"},
+		MaxAge:         600,
+	}
+	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalOPTIONS = true
+	})
+
+	preflight := func() *http.Request {
+		r := httptest.NewRequest(http.MethodOptions, "/path", nil)
+		r.Header.Set("Origin", "https://example.com")
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		return r
+	}
+
+	// preflight: Allow and CORS headers in one response
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight())
+	if w.Code != http.StatusNoContent {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	want := map[string]string{
+		"Allow":                        "GET, OPTIONS, POST",
+		"Access-Control-Allow-Origin":  "https://example.com",
+		"Access-Control-Allow-Methods": "GET, OPTIONS, POST",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("wrong %s header: want %q, got %q", header, value, got)
+		}
+	}
+	if globalOPTIONS {
+		t.Error("GlobalOPTIONS called for preflight request")
+	}
+
+	// disallowed origin: no CORS headers
+	r := preflight()
+	r.Header.Set("Origin", "https://evil.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Allow") == "" || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("wrong headers for disallowed origin: %v", w.Header())
+	}
+
+	// plain OPTIONS requests are still handled by GlobalOPTIONS
+	r = httptest.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !globalOPTIONS || w.Header().Get("Allow") != "GET, OPTIONS, POST" {
+		t.Errorf("GlobalOPTIONS not called for plain OPTIONS request")
+	}
+
+	// actual request
+	r = httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("wrong Access-Control-Allow-Origin header: %q", got)
+	}
+
+	// explicit OPTIONS handlers take precedence
+	var custom bool
+	router.OPTIONS("/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		custom = true
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, preflight())
+	if !custom {
+		t.Error("custom OPTIONS handler not called")
+	}
+}
+
+func TestRouterCORSWildcardCredentials(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.CORS = &CORS{
+		AllowedOrigins:   []string{"*", "https://example.com"},
+		AllowCredentials: true,
+	}
+
+	tests := []struct {
+		method      string
+		origin      string
+		allow       string
+		credentials string
+	}{
+		{http.MethodGet, "https://evil.com", "*", ""},
+		{http.MethodOptions, "https://evil.com", "*", ""},
+		{http.MethodGet, "https://example.com", "https://example.com", "true"},
+		{http.MethodOptions, "https://example.com", "https://example.com", "true"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/path", nil)
+		r.Header.Set("Origin", test.origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.allow {
+			t.Errorf("%s from %s: wrong Access-Control-Allow-Origin header: want %q, got %q", test.method, test.origin, test.allow, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != test.credentials {
+			t.Errorf("%s from %s: wrong Access-Control-Allow-Credentials header: want %q, got %q", test.method, test.origin, test.credentials, got)
+		}
+	}
+}
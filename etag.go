@@ -0,0 +1,158 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bytes"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultETagMaxSize is the maximum size of a response body in bytes for which
+// the middleware returned by ETag computes an ETag.
+const DefaultETagMaxSize = 1 << 20
+
+// ETag returns a middleware which computes an ETag for responses with status
+// code 200 to GET and HEAD requests and answers conditional requests with a
+// matching If-None-Match header with status code 304.
+// It is a shortcut for ETagMaxSize(DefaultETagMaxSize).
+func ETag() func(Handle) Handle {
+	return ETagMaxSize(DefaultETagMaxSize)
+}
+
+// ETagMaxSize is like ETag, but with a custom maximum body size in bytes.
+// Since the response body must be buffered to compute its hash, responses
+// exceeding the maximum size are streamed without an ETag instead. The same
+// applies if the handle flushes the response.
+// An ETag header set by the handle itself is kept. For HEAD requests on which
+// the handle writes no body, neither ETag nor Content-Length is set unless the
+// handle sets them itself.
+func ETagMaxSize(maxSize int) func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				next(w, req, ps)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, maxSize: maxSize}
+			next(ew, req, ps)
+			ew.finish(req)
+		}
+	}
+}
+
+// etagWriter buffers the response body until it is complete or exceeds the
+// maximum size.
+type etagWriter struct {
+	http.ResponseWriter
+
+	maxSize     int
+	status      int
+	buf         bytes.Buffer
+	passThrough bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.passThrough || ew.status != 0 {
+		return
+	}
+	ew.status = code
+	if code != http.StatusOK {
+		ew.startPassThrough()
+	}
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if ew.status == 0 {
+		ew.status = http.StatusOK
+	}
+	if !ew.passThrough && ew.buf.Len()+len(p) > ew.maxSize {
+		ew.startPassThrough()
+	}
+	if ew.passThrough {
+		return ew.ResponseWriter.Write(p)
+	}
+	return ew.buf.Write(p)
+}
+
+// Flush implements http.Flusher. Flushed responses are streamed without ETag.
+func (ew *etagWriter) Flush() {
+	if !ew.passThrough {
+		if ew.status == 0 {
+			ew.status = http.StatusOK
+		}
+		ew.startPassThrough()
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// startPassThrough writes the header and the buffered body to the underlying
+// writer, which is used directly afterwards.
+func (ew *etagWriter) startPassThrough() {
+	ew.passThrough = true
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if ew.buf.Len() > 0 {
+		ew.ResponseWriter.Write(ew.buf.Bytes())
+		ew.buf.Reset()
+	}
+}
+
+func (ew *etagWriter) finish(req *http.Request) {
+	if ew.passThrough {
+		return
+	}
+	if ew.status == 0 {
+		// nothing was written
+		ew.status = http.StatusOK
+	}
+
+	h := ew.ResponseWriter.Header()
+	etag := h.Get("ETag")
+
+	// A HEAD handle usually writes no body, so the hash and length of the
+	// empty buffer would not describe the resource.
+	headOnly := req.Method == http.MethodHead && ew.buf.Len() == 0
+
+	if etag == "" && !headOnly {
+		hash := fnv.New64a()
+		hash.Write(ew.buf.Bytes())
+		etag = `"` + strconv.FormatUint(hash.Sum64(), 16) + `"`
+		h.Set("ETag", etag)
+	}
+
+	if etag != "" && etagMatch(req.Header.Get("If-None-Match"), etag) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if h.Get("Content-Length") == "" && !headOnly {
+		h.Set("Content-Length", strconv.Itoa(ew.buf.Len()))
+	}
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.ResponseWriter.Write(ew.buf.Bytes())
+}
+
+// etagMatch reports whether the If-None-Match header matches the ETag, using
+// the weak comparison function.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
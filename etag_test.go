@@ -0,0 +1,121 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	body := `{"hello":"world"}`
+
+	router := New()
+	router.Use(ETagMaxSize(64))
+	router.GET("/data", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+	router.GET("/large", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	})
+	router.GET("/error", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+
+	// 200 with ETag
+	r := httptest.NewRequest(http.MethodGet, "/data", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("wrong response: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+	if etag == "" {
+		t.Fatal("no ETag set")
+	}
+
+	// conditional request
+	r = httptest.NewRequest(http.MethodGet, "/data", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("conditional request failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("ETag missing in 304 response")
+	}
+
+	// non-matching conditional request
+	r = httptest.NewRequest(http.MethodGet, "/data", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Errorf("wrong response: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	// responses above the size cap are streamed without ETag
+	r = httptest.NewRequest(http.MethodGet, "/large", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 100 || w.Header().Get("ETag") != "" {
+		t.Errorf("wrong response above size cap: Code=%d, Len=%d, ETag=%q", w.Code, w.Body.Len(), w.Header().Get("ETag"))
+	}
+
+	// non-200 responses get no ETag
+	r = httptest.NewRequest(http.MethodGet, "/error", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError || w.Header().Get("ETag") != "" {
+		t.Errorf("wrong error response: Code=%d, ETag=%q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestETagHead(t *testing.T) {
+	const etag = `"v1"`
+
+	router := New()
+	router.Use(ETag())
+	router.HEAD("/bare", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.HEAD("/tagged", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", "42")
+	})
+
+	// no body written: no ETag of the empty body
+	r := httptest.NewRequest(http.MethodHead, "/bare", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != "" {
+		t.Errorf("unexpected ETag %q", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("unexpected Content-Length %q", got)
+	}
+
+	// headers set by the handle are kept
+	r = httptest.NewRequest(http.MethodHead, "/tagged", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != etag || w.Header().Get("Content-Length") != "42" {
+		t.Errorf("wrong response: Code=%d, ETag=%q, Content-Length=%q", w.Code, w.Header().Get("ETag"), w.Header().Get("Content-Length"))
+	}
+
+	// conditional request with the handle's ETag
+	r = httptest.NewRequest(http.MethodHead, "/tagged", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional request failed: Code=%d", w.Code)
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+// FileServeOptions configures how files are served by
+// Router.ServeFilesWithOptions.
+type FileServeOptions struct {
+	// An optional function which is called after a file was served, e.g. for
+	// auditing asset access. It receives the requested file name, the size of
+	// the resolved file, or 0 if no file was found, and the response status
+	// code.
+	OnServe func(name string, size int64, status int)
+
+	// If enabled, Range requests are answered with the whole file and status
+	// code 200 and the files are served with the header Accept-Ranges: none.
+	// By default byte ranges are supported, e.g. for video streaming, and
+	// answered with status code 206 and a Content-Range header.
+	DisableRanges bool
+
+	// If enabled, requests whose file path contains a ".." element, e.g.
+	// /static/../../etc/passwd, are answered with http.NotFound before the
+	// file system is accessed, instead of relying on the file system to
+	// contain the path.
+	RejectDotDot bool
+
+	// If enabled, a gzip-compressed sibling of the requested file, e.g.
+	// app.css.gz for app.css, is served with the header Content-Encoding: gzip
+	// to clients accepting gzip, instead of the file itself. The Content-Type
+	// is derived from the extension of the requested file. Without such a
+	// sibling, or if the client does not accept gzip, the file itself is
+	// served.
+	PrecompressedGzip bool
+}
+
+// ServeFilesWithOptions is like ServeFiles, but additionally accepts options.
+// Files are only read as long as the context of the request is not canceled,
+// e.g. by a client abandoning a download. Files of the operating system, e.g.
+// from http.Dir, are passed to the server as they are, so that it can send them
+// with sendfile; the server stops sending them once the connection is closed.
+func (r *Router) ServeFilesWithOptions(path string, root http.FileSystem, opts FileServeOptions) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+
+	r.GET(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
+		name := ps.ByName("filepath")
+		if opts.RejectDotDot && containsDotDot(name) {
+			http.NotFound(w, req)
+			if opts.OnServe != nil {
+				opts.OnServe(name, 0, http.StatusNotFound)
+			}
+			return
+		}
+		req.URL.Path = name
+
+		if opts.DisableRanges {
+			req.Header.Del("Range")
+			w = noRangesWriter{w}
+		}
+
+		// Reading files stops once the request is canceled
+		var fs http.FileSystem = ctxFileSystem{root, req.Context()}
+		var sfs *statFileSystem
+		var sw *statusWriter
+		if opts.OnServe != nil {
+			sfs = &statFileSystem{FileSystem: fs}
+			sw = &statusWriter{ResponseWriter: w}
+			fs, w = sfs, sw
+		}
+
+		if !opts.PrecompressedGzip || !servePrecompressed(w, req, fs, name) {
+			http.FileServer(fs).ServeHTTP(w, req)
+		}
+
+		if opts.OnServe != nil {
+			opts.OnServe(name, sfs.size, sw.status)
+		}
+	})
+}
+
+// servePrecompressed serves the gzip-compressed sibling of the file name, if
+// the client accepts gzip and the sibling exists. It reports whether it was
+// served.
+func servePrecompressed(w http.ResponseWriter, req *http.Request, fs http.FileSystem, name string) bool {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if strings.HasSuffix(name, "/") || !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		return false
+	}
+
+	ctype := mime.TypeByExtension(pathpkg.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("Content-Encoding", "gzip")
+	if serveContent(w, req, fs, name+".gz") {
+		return true
+	}
+	h.Del("Content-Type")
+	h.Del("Content-Encoding")
+	return false
+}
+
+// acceptsGzip reports whether the Accept-Encoding header accepts gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		switch name, q := parseMediaRange(coding); name {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// noRangesWriter replaces the Accept-Ranges header set by http.ServeContent,
+// which always calls WriteHeader before writing, so that clients do not
+// attempt Range requests.
+type noRangesWriter struct {
+	http.ResponseWriter
+}
+
+func (w noRangesWriter) WriteHeader(code int) {
+	if w.Header().Get("Accept-Ranges") != "" {
+		w.Header().Set("Accept-Ranges", "none")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// ServeSPA serves a single-page app from the given file system under the path
+// prefix, e.g. /app. Requests for existing files are answered with the file.
+// Requests for other paths under the prefix are answered with the index file,
+// e.g. "index.html", and status code 200, so that the app can handle its own
+// routes. Requests for missing files with an extension, e.g. /app/missing.js,
+// are still answered with 404, using http.NotFound.
+// Handles are registered for GET and HEAD requests of prefix + "/*filepath".
+//
+//	router.ServeSPA("/app", http.Dir("/var/www/app"), "index.html")
+func (r *Router) ServeSPA(prefix string, fs http.FileSystem, index string) {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	path := strings.TrimSuffix(prefix, "/") + "/*filepath"
+
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		// Not every file system cleans the name like http.Dir does
+		name := pathpkg.Clean("/" + ps.ByName("filepath"))
+		if serveContent(w, req, fs, name) {
+			return
+		}
+		if pathpkg.Ext(name) != "" || !serveContent(w, req, fs, index) {
+			http.NotFound(w, req)
+		}
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// ServeManifest serves content-hashed assets from the given file system under
+// the path prefix, e.g. /assets. The manifest maps asset names, as requested
+// under the prefix, to the names of the files in the file system, e.g.
+// "app.js" to "app.3f2a1b.js". Since the content of a hashed file never
+// changes, assets are served with a Cache-Control header allowing clients to
+// cache them for a year without revalidation.
+// Handles are registered for GET and HEAD requests of each asset, so requests
+// for assets missing from the manifest are answered by the NotFound handler.
+//
+//	router.ServeManifest("/assets", http.Dir("/var/www/dist"), map[string]string{
+//		"app.js":  "app.3f2a1b.js",
+//		"app.css": "app.9c8d7e.css",
+//	})
+func (r *Router) ServeManifest(prefix string, fs http.FileSystem, manifest map[string]string) {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	for asset, file := range manifest {
+		file := file
+		handle := func(w http.ResponseWriter, req *http.Request, _ Params) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			if !serveContent(w, req, fs, file) {
+				w.Header().Del("Cache-Control")
+				http.NotFound(w, req)
+			}
+		}
+
+		path := prefix + "/" + strings.TrimPrefix(asset, "/")
+		r.GET(path, handle)
+		r.HEAD(path, handle)
+	}
+}
+
+// containsDotDot reports whether the file path contains a ".." element,
+// separated by '/' or '\\'.
+func containsDotDot(name string) bool {
+	if !strings.Contains(name, "..") {
+		return false
+	}
+	for _, elem := range strings.FieldsFunc(name, func(c rune) bool { return c == '/' || c == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// serveContent serves the regular file name from the file system with
+// http.ServeContent. It reports whether the file could be served.
+func serveContent(w http.ResponseWriter, req *http.Request, fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		return false
+	}
+	http.ServeContent(w, req, d.Name(), d.ModTime(), f)
+	return true
+}
+
+// ctxFileSystem opens files whose reads fail once the context is canceled,
+// so that abandoned downloads stop reading. An *os.File is returned as it is,
+// since wrapping it would prevent the server from sending it with sendfile.
+type ctxFileSystem struct {
+	http.FileSystem
+	ctx context.Context
+}
+
+func (fs ctxFileSystem) Open(name string) (http.File, error) {
+	if err := fs.ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.(*os.File); ok {
+		return f, nil
+	}
+	return ctxFile{f, fs.ctx}, nil
+}
+
+type ctxFile struct {
+	http.File
+	ctx context.Context
+}
+
+func (f ctxFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+// statFileSystem records the size of the last regular file opened.
+type statFileSystem struct {
+	http.FileSystem
+	size int64
+}
+
+func (fs *statFileSystem) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, err := f.Stat(); err == nil && !d.IsDir() {
+		fs.size = d.Size()
+	}
+	return f, nil
+}
+
+// statusWriter records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
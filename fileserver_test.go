@@ -0,0 +1,393 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestRouterServeFilesOnServe(t *testing.T) {
+	type served struct {
+		name   string
+		size   int64
+		status int
+	}
+	var got served
+
+	fsys := fstest.MapFS{
+		"app.js": &fstest.MapFile{Data: []byte("console.log(1)")},
+	}
+
+	router := New()
+	router.ServeFilesWithOptions("/static/*filepath", http.FS(fsys), FileServeOptions{
+		OnServe: func(name string, size int64, status int) {
+			got = served{name, size, status}
+		},
+	})
+
+	tests := []struct {
+		route string
+		want  served
+	}{
+		{"/static/app.js", served{"/app.js", 14, http.StatusOK}},
+		{"/static/missing.js", served{"/missing.js", 0, http.StatusNotFound}},
+	}
+	for _, test := range tests {
+		got = served{}
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.want.status {
+			t.Errorf("%s: wrong status code: %d", test.route, w.Code)
+		}
+		if got != test.want {
+			t.Errorf("%s: wrong OnServe values: want %+v, got %+v", test.route, test.want, got)
+		}
+	}
+}
+
+func TestRouterServeFilesRange(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fsys := fstest.MapFS{
+		"video.mp4": &fstest.MapFile{Data: data},
+	}
+
+	router := New()
+	router.ServeFiles("/static/*filepath", http.FS(fsys))
+	router.ServeFilesWithOptions("/noranges/*filepath", http.FS(fsys), FileServeOptions{
+		DisableRanges: true,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/static/video.mp4", nil)
+	r.Header.Set("Range", "bytes=0-99")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("want status 206, got %d", w.Code)
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "bytes 0-99/1000" {
+		t.Errorf("wrong Content-Range: %q", cr)
+	}
+	if ar := w.Header().Get("Accept-Ranges"); ar != "bytes" {
+		t.Errorf("wrong Accept-Ranges: %q", ar)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data[:100]) {
+		t.Errorf("wrong body of %d bytes", w.Body.Len())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/noranges/video.mp4", nil)
+	r.Header.Set("Range", "bytes=0-99")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("ranges disabled: want status 200, got %d", w.Code)
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "" {
+		t.Errorf("ranges disabled: unexpected Content-Range: %q", cr)
+	}
+	if ar := w.Header().Get("Accept-Ranges"); ar != "none" {
+		t.Errorf("ranges disabled: wrong Accept-Ranges: %q", ar)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("ranges disabled: wrong body of %d bytes", w.Body.Len())
+	}
+}
+
+// openRecorder records the names of the files opened.
+type openRecorder struct {
+	http.FileSystem
+	opened []string
+}
+
+func (fs *openRecorder) Open(name string) (http.File, error) {
+	fs.opened = append(fs.opened, name)
+	return fs.FileSystem.Open(name)
+}
+
+func TestRouterServeFilesRejectDotDot(t *testing.T) {
+	fs := &openRecorder{FileSystem: http.FS(fstest.MapFS{
+		"app.js":  &fstest.MapFile{Data: []byte("console.log(1)")},
+		"a..b.js": &fstest.MapFile{Data: []byte("console.log(2)")},
+	})}
+
+	router := New()
+	router.ServeFilesWithOptions("/static/*filepath", fs, FileServeOptions{
+		RejectDotDot: true,
+	})
+
+	tests := []struct {
+		route string
+		code  int
+	}{
+		{"/static/app.js", http.StatusOK},
+		{"/static/a..b.js", http.StatusOK},
+		{"/static/%2e%2e/%2e%2e/etc/passwd", http.StatusNotFound},
+		{"/static/..%2f..%2fetc/passwd", http.StatusNotFound},
+		{"/static/css/%2E%2E/%2E%2E/etc/passwd", http.StatusNotFound},
+		{"/static/..%5c..%5cwindows/win.ini", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		fs.opened = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: want status %d, got %d", test.route, test.code, w.Code)
+		}
+		if test.code == http.StatusNotFound && len(fs.opened) > 0 {
+			t.Errorf("%s: file system was accessed: %v", test.route, fs.opened)
+		}
+	}
+}
+
+func TestRouterServeFilesPrecompressedGzip(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("body{color:red}"))
+	zw.Close()
+
+	fsys := fstest.MapFS{
+		"app.css":    &fstest.MapFile{Data: []byte("body{color:red}")},
+		"app.css.gz": &fstest.MapFile{Data: gz.Bytes()},
+		"app.js":     &fstest.MapFile{Data: []byte("console.log(1)")},
+	}
+
+	router := New()
+	router.ServeFilesWithOptions("/static/*filepath", http.FS(fsys), FileServeOptions{
+		PrecompressedGzip: true,
+	})
+
+	tests := []struct {
+		route          string
+		acceptEncoding string
+		gzipped        bool
+		contentType    string
+		body           []byte
+	}{
+		{"/static/app.css", "gzip, deflate", true, "text/css; charset=utf-8", gz.Bytes()},
+		{"/static/app.css", "br;q=1.0, gzip;q=0.8", true, "text/css; charset=utf-8", gz.Bytes()},
+		{"/static/app.css", "*", true, "text/css; charset=utf-8", gz.Bytes()},
+		{"/static/app.css", "", false, "text/css; charset=utf-8", []byte("body{color:red}")},
+		{"/static/app.css", "gzip;q=0, *", false, "text/css; charset=utf-8", []byte("body{color:red}")},
+		{"/static/app.js", "gzip", false, "", []byte("console.log(1)")},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		name := test.route + " " + test.acceptEncoding
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: want status 200, got %d", name, w.Code)
+		}
+		if ce := w.Header().Get("Content-Encoding"); (ce == "gzip") != test.gzipped {
+			t.Errorf("%s: wrong Content-Encoding: %q", name, ce)
+		}
+		if ct := w.Header().Get("Content-Type"); test.contentType != "" && ct != test.contentType {
+			t.Errorf("%s: wrong Content-Type: want %q, got %q", name, test.contentType, ct)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: wrong Vary header: %q", name, vary)
+		}
+		if !bytes.Equal(w.Body.Bytes(), test.body) {
+			t.Errorf("%s: wrong body: %q", name, w.Body.Bytes())
+		}
+	}
+}
+
+// slowFile is an in-memory file which calls onRead before every read.
+type slowFile struct {
+	*bytes.Reader
+	size   int64
+	onRead func()
+}
+
+func (f *slowFile) Read(p []byte) (int, error) {
+	f.onRead()
+	time.Sleep(time.Millisecond)
+	return f.Reader.Read(p)
+}
+
+func (f *slowFile) Close() error                       { return nil }
+func (f *slowFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *slowFile) Stat() (os.FileInfo, error)         { return f, nil }
+func (f *slowFile) Name() string                       { return "large.txt" }
+func (f *slowFile) Size() int64                        { return f.size }
+func (f *slowFile) Mode() os.FileMode                  { return 0444 }
+func (f *slowFile) ModTime() time.Time                 { return time.Time{} }
+func (f *slowFile) IsDir() bool                        { return false }
+func (f *slowFile) Sys() interface{}                   { return nil }
+
+type slowFileSystem struct {
+	file *slowFile
+}
+
+func (fs slowFileSystem) Open(string) (http.File, error) {
+	return fs.file, nil
+}
+
+func TestRouterServeFilesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := make([]byte, 1<<20)
+	var reads int
+	file := &slowFile{
+		Reader: bytes.NewReader(data),
+		size:   int64(len(data)),
+		onRead: func() {
+			// the client abandons the download after the first read
+			reads++
+			if reads == 1 {
+				cancel()
+			}
+		},
+	}
+
+	router := New()
+	router.ServeFiles("/files/*filepath", slowFileSystem{file})
+
+	r := httptest.NewRequest(http.MethodGet, "/files/large.txt", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if reads != 1 {
+		t.Errorf("read loop did not stop after cancellation: %d reads", reads)
+	}
+	if w.Body.Len() >= len(data) {
+		t.Errorf("whole file was copied: %d bytes", w.Body.Len())
+	}
+}
+
+func TestCtxFileSystem(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fs := ctxFileSystem{http.Dir("."), ctx}
+
+	// files of the operating system are not wrapped, see ServeFilesWithOptions
+	f, err := fs.Open("/fileserver.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*os.File); !ok {
+		t.Errorf("want *os.File, got %T", f)
+	}
+	f.Close()
+
+	cancel()
+	if _, err := fs.Open("/fileserver.go"); err != context.Canceled {
+		t.Errorf("want error %v after cancellation, got %v", context.Canceled, err)
+	}
+}
+
+func TestRouterServeSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    &fstest.MapFile{Data: []byte("<html>app</html>")},
+		"assets/app.js": &fstest.MapFile{Data: []byte("console.log(1)")},
+	}
+
+	router := New()
+	router.ServeSPA("/app", http.FS(fsys), "index.html")
+	router.GET("/api/users", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/app/unknown-route", http.StatusOK, "<html>app</html>"},
+		{"/app/users/42", http.StatusOK, "<html>app</html>"},
+		{"/app/", http.StatusOK, "<html>app</html>"},
+		{"/app/assets/app.js", http.StatusOK, "console.log(1)"},
+		{"/app/missing.js", http.StatusNotFound, ""},
+		{"/api/unknown", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: want status %d, got %d", test.path, test.code, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: want body %q, got %q", test.path, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestRouterServeSPADotDot(t *testing.T) {
+	fs := &openRecorder{FileSystem: http.FS(fstest.MapFS{
+		"index.html": &fstest.MapFile{Data: []byte("<html>app</html>")},
+	})}
+
+	router := New()
+	router.ServeSPA("/app", fs, "index.html")
+
+	for _, path := range []string{"/app/../secret", "/app/%2e%2e/%2e%2e/etc/passwd", "/app/a/../../index.html"} {
+		fs.opened = nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		for _, name := range fs.opened {
+			if containsDotDot(name) {
+				t.Errorf("%s: file system opened %q", path, name)
+			}
+		}
+	}
+}
+
+func TestRouterServeManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.3f2a1b.js":  &fstest.MapFile{Data: []byte("console.log(1)")},
+		"app.9c8d7e.css": &fstest.MapFile{Data: []byte("body{}")},
+	}
+
+	router := New()
+	router.ServeManifest("/assets", http.FS(fsys), map[string]string{
+		"app.js":  "app.3f2a1b.js",
+		"app.css": "app.9c8d7e.css",
+		"gone.js": "gone.1a2b3c.js",
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/assets/app.js", http.StatusOK, "console.log(1)"},
+		{"/assets/app.css", http.StatusOK, "body{}"},
+		{"/assets/app.3f2a1b.js", http.StatusNotFound, ""},
+		{"/assets/unknown.js", http.StatusNotFound, ""},
+		{"/assets/gone.js", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: want status %d, got %d", test.path, test.code, w.Code)
+		}
+		cacheControl := w.Header().Get("Cache-Control")
+		if test.code == http.StatusOK {
+			if w.Body.String() != test.body {
+				t.Errorf("%s: want body %q, got %q", test.path, test.body, w.Body.String())
+			}
+			if !strings.Contains(cacheControl, "immutable") {
+				t.Errorf("%s: want immutable Cache-Control, got %q", test.path, cacheControl)
+			}
+		} else if cacheControl != "" {
+			t.Errorf("%s: want no Cache-Control, got %q", test.path, cacheControl)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HeadResponseWriter is a http.ResponseWriter which discards the body, but
+// counts its bytes. See HeadWriter.
+type HeadResponseWriter struct {
+	http.ResponseWriter
+
+	status   int
+	written  int64
+	finished bool
+}
+
+// HeadWriter wraps the given http.ResponseWriter for answering HEAD requests
+// with the logic of a GET handle:
+//
+//	router.HEAD("/data", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+//	    hw := httprouter.HeadWriter(w)
+//	    getData(hw, r, ps)
+//	    hw.Finish()
+//	})
+//
+// The body written to it never reaches the underlying writer. Instead the
+// status code and the header, including a Content-Length header with the
+// number of discarded bytes, are written when Finish is called.
+// HeadResponseWriter deliberately does not implement http.Flusher, since
+// flushing in the middle of the body would send an incomplete Content-Length.
+func HeadWriter(w http.ResponseWriter) *HeadResponseWriter {
+	return &HeadResponseWriter{ResponseWriter: w}
+}
+
+// Write discards p, but counts its length.
+func (hw *HeadResponseWriter) Write(p []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.written += int64(len(p))
+	return len(p), nil
+}
+
+// WriteHeader records the status code, which is written on Finish.
+func (hw *HeadResponseWriter) WriteHeader(code int) {
+	if hw.status == 0 {
+		hw.status = code
+	}
+}
+
+// Written returns the number of body bytes discarded so far.
+func (hw *HeadResponseWriter) Written() int64 {
+	return hw.written
+}
+
+// Finish writes the status code and the header to the underlying writer.
+// The Content-Length header is set to the number of discarded bytes, unless
+// it was set explicitly. It must be called after the body is complete.
+// Only the first call has an effect.
+func (hw *HeadResponseWriter) Finish() {
+	if hw.finished {
+		return
+	}
+	hw.finished = true
+
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	h := hw.ResponseWriter.Header()
+	if h.Get("Content-Length") == "" && hw.status != http.StatusNoContent &&
+		hw.status != http.StatusNotModified && hw.status >= http.StatusOK {
+		h.Set("Content-Length", strconv.FormatInt(hw.written, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
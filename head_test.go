@@ -0,0 +1,64 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeadWriter(t *testing.T) {
+	get := func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(bytes.Repeat([]byte("a"), 60))
+		w.Write(bytes.Repeat([]byte("b"), 40))
+	}
+
+	router := New()
+	router.GET("/data", get)
+	router.HEAD("/data", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		hw := HeadWriter(w)
+		get(hw, r, ps)
+		// flushing mid-stream must not send the header early
+		if f, ok := interface{}(hw).(http.Flusher); ok {
+			f.Flush()
+		}
+		hw.Write(bytes.Repeat([]byte("c"), 20))
+		if hw.Written() != 120 {
+			t.Errorf("wrong number of written bytes: %d", hw.Written())
+		}
+		hw.Finish()
+	})
+
+	r := httptest.NewRequest(http.MethodHead, "/data", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body reached the underlying writer: %q", w.Body.String())
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "120" {
+		t.Errorf("wrong Content-Length: %q", cl)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("header not passed through: Content-Type=%q", ct)
+	}
+
+	// status codes are passed through
+	w = httptest.NewRecorder()
+	hw := HeadWriter(w)
+	hw.WriteHeader(http.StatusNotModified)
+	hw.Finish()
+	if w.Code != http.StatusNotModified {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Content-Length set for 304: %q", cl)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HostRouter is a http.Handler which dispatches requests to different routers
+// based on the host of the request.
+// Host patterns consist of dot-separated labels. A label starting with ':' is
+// a parameter matching exactly one label, e.g. ":tenant.example.com" matches
+// acme.example.com, but neither example.com nor a.b.example.com.
+// The captured host params are appended to the path params of the routes of
+// the router which handles the request.
+type HostRouter struct {
+	static   map[string]http.Handler
+	patterns []hostPattern
+
+	// Configurable http.Handler which is called when no host pattern matches.
+	// If it is not set, http.NotFound is used.
+	NotFound http.Handler
+}
+
+type hostPattern struct {
+	labels  []string
+	handler http.Handler
+}
+
+// NewHostRouter returns a new initialized HostRouter.
+func NewHostRouter() *HostRouter {
+	return &HostRouter{}
+}
+
+// Host registers the router for requests whose host matches the given
+// pattern. Hosts are matched case-insensitively and without the port.
+// Patterns without parameters take precedence, otherwise the patterns are
+// tried in the order they were registered.
+func (hr *HostRouter) Host(pattern string, router *Router) {
+	hr.Handler(pattern, router)
+}
+
+// Handler is like Host, but accepts any http.Handler. Host params are
+// available in the request context under ParamsKey.
+func (hr *HostRouter) Handler(pattern string, handler http.Handler) {
+	if pattern == "" {
+		panic("host pattern must not be empty")
+	}
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+
+	pattern = strings.ToLower(pattern)
+	labels := strings.Split(pattern, ".")
+	wild := false
+	for _, label := range labels {
+		if label == "" || label == ":" {
+			panic("empty label in host pattern '" + pattern + "'")
+		}
+		if label[0] == ':' {
+			wild = true
+		}
+	}
+
+	if !wild {
+		if hr.static == nil {
+			hr.static = make(map[string]http.Handler)
+		}
+		if _, ok := hr.static[pattern]; ok {
+			panic("a handler is already registered for host '" + pattern + "'")
+		}
+		hr.static[pattern] = handler
+		return
+	}
+
+	for _, p := range hr.patterns {
+		if strings.Join(p.labels, ".") == pattern {
+			panic("a handler is already registered for host '" + pattern + "'")
+		}
+	}
+	hr.patterns = append(hr.patterns, hostPattern{labels: labels, handler: handler})
+}
+
+// match reports whether the host labels match the pattern and returns the
+// captured params.
+func (p *hostPattern) match(labels []string) (Params, bool) {
+	if len(labels) != len(p.labels) {
+		return nil, false
+	}
+	var ps Params
+	for i, label := range p.labels {
+		if label[0] == ':' {
+			ps = append(ps, Param{Key: label[1:], Value: labels[i]})
+		} else if label != labels[i] {
+			return nil, false
+		}
+	}
+	return ps, true
+}
+
+// stripPort removes the port, if any, from the host.
+func stripPort(host string) string {
+	i := strings.LastIndexByte(host, ':')
+	if i < 0 || strings.IndexByte(host[i:], ']') >= 0 {
+		return host
+	}
+	return host[:i]
+}
+
+// ServeHTTP makes the host router implement the http.Handler interface.
+func (hr *HostRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := strings.ToLower(stripPort(req.Host))
+
+	if handler, ok := hr.static[host]; ok {
+		handler.ServeHTTP(w, req)
+		return
+	}
+
+	labels := strings.Split(host, ".")
+	for i := range hr.patterns {
+		if ps, ok := hr.patterns[i].match(labels); ok {
+			hr.patterns[i].handler.ServeHTTP(w, withParams(req, inheritParams(req, ps)))
+			return
+		}
+	}
+
+	if hr.NotFound != nil {
+		hr.NotFound.ServeHTTP(w, req)
+	} else {
+		http.NotFound(w, req)
+	}
+}
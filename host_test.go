@@ -0,0 +1,74 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHostRouter(t *testing.T) {
+	var got Params
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			got = append(Params(nil), ps...)
+		}
+	}
+
+	tenants := New()
+	tenants.GET("/users/:id", handle("tenant"))
+	www := New()
+	www.GET("/users/:id", handle("www"))
+
+	hr := NewHostRouter()
+	hr.Host(":tenant.example.com", tenants)
+	hr.Host("www.example.com", www)
+
+	tests := []struct {
+		host   string
+		path   string
+		routed string
+		ps     Params
+	}{
+		{"acme.example.com", "/users/1", "tenant", Params{{"id", "1"}, {"tenant", "acme"}}},
+		{"ACME.example.com:8080", "/users/2", "tenant", Params{{"id", "2"}, {"tenant", "acme"}}},
+		{"www.example.com", "/users/3", "www", Params{{"id", "3"}}},
+		{"a.b.example.com", "/users/4", "", nil},
+		{"example.com", "/users/5", "", nil},
+	}
+	for _, test := range tests {
+		routed, got = "", nil
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		hr.ServeHTTP(w, r)
+		if routed != test.routed {
+			t.Errorf("%s: want router %q, got %q", test.host+test.path, test.routed, routed)
+		}
+		if !reflect.DeepEqual(got, test.ps) {
+			t.Errorf("%s: wrong params: want %v, got %v", test.host+test.path, test.ps, got)
+		}
+		if test.routed == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", test.host+test.path, w.Code)
+		}
+	}
+
+	recv := catchPanic(func() {
+		hr.Host(":tenant.example.com", tenants)
+	})
+	if recv == nil {
+		t.Error("registering a duplicate host pattern did not panic")
+	}
+	recv = catchPanic(func() {
+		hr.Host("www..example.com", www)
+	})
+	if recv == nil {
+		t.Error("registering a host pattern with an empty label did not panic")
+	}
+}
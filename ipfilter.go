@@ -0,0 +1,123 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilter returns middleware which restricts access by the client IP address,
+// see Router.Use. allow and deny hold IPv4 or IPv6 addresses and networks in
+// CIDR notation, e.g. "10.0.0.0/8", "2001:db8::/32" or "192.0.2.1".
+// A request from a denied address is answered with status code 403. If allow
+// is not empty, the same applies to requests from any address not allowed.
+// Deny takes precedence over allow.
+// The client address is taken from the RemoteAddr of the request. If it can not
+// be parsed, the request is rejected, unless both lists are empty.
+// IPFilter panics if an entry can not be parsed.
+// It is a shortcut for IPFilterProxies(allow, deny, nil).
+//
+//	router.Use(httprouter.IPFilter([]string{"10.0.0.0/8"}, []string{"10.0.13.0/24"}))
+func IPFilter(allow, deny []string) func(Handle) Handle {
+	return IPFilterProxies(allow, deny, nil)
+}
+
+// IPFilterProxies is like IPFilter, but trusts the X-Forwarded-For header of
+// requests from the given proxies, e.g. a load balancer in front of the server.
+// The client address is then the last address in the header which is not a
+// trusted proxy itself. Requests from other addresses are filtered by their
+// RemoteAddr, so that clients can not bypass the filter by sending the header
+// themselves.
+func IPFilterProxies(allow, deny, proxies []string) func(Handle) Handle {
+	allowNets := parseIPNets(allow)
+	denyNets := parseIPNets(deny)
+	proxyNets := parseIPNets(proxies)
+
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			ip := clientIP(req, proxyNets)
+			if (len(allowNets) > 0 || len(denyNets) > 0) &&
+				(ip == nil || containsIP(denyNets, ip) ||
+					(len(allowNets) > 0 && !containsIP(allowNets, ip))) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next(w, req, ps)
+		}
+	}
+}
+
+// parseIPNets parses addresses and networks in CIDR notation. Addresses are
+// converted to networks with a single address.
+func parseIPNets(entries []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				panic("invalid IP address '" + entry + "'")
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			panic("invalid CIDR '" + entry + "': " + err.Error())
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses an address with an optional port and IPv6 zone, e.g.
+// "192.0.2.1:1234" or "[fe80::1%eth0]:1234". It returns nil if the address is
+// malformed.
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr = addr[:i]
+	}
+	return net.ParseIP(addr)
+}
+
+// clientIP returns the address of the client, taking X-Forwarded-For into
+// account for requests from trusted proxies.
+func clientIP(req *http.Request, proxies []*net.IPNet) net.IP {
+	ip := parseIP(req.RemoteAddr)
+	if ip == nil || !containsIP(proxies, ip) {
+		return ip
+	}
+
+	// Walk the proxy chain backwards until an untrusted address is reached
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		if strings.TrimSpace(hops[i]) == "" {
+			continue
+		}
+		ip = parseIP(hops[i])
+		if ip == nil || !containsIP(proxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
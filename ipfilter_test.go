@@ -0,0 +1,117 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	router := New()
+	router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(IPFilter(
+		[]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"},
+		[]string{"10.0.13.0/24", "2001:db8:bad::/48"},
+	))
+
+	tests := []struct {
+		remoteAddr string
+		code       int
+	}{
+		{"10.1.2.3:1234", http.StatusOK},
+		{"192.0.2.1:1234", http.StatusOK},
+		{"192.0.2.2:1234", http.StatusForbidden},
+		{"10.0.13.7:1234", http.StatusForbidden}, // denied CIDR
+		{"8.8.8.8:53", http.StatusForbidden},     // not allowed
+		{"[2001:db8::1]:443", http.StatusOK},
+		{"[2001:db8:bad::1]:443", http.StatusForbidden},
+		{"[fe80::1%eth0]:443", http.StatusForbidden},
+		{"[::ffff:10.1.2.3]:1234", http.StatusOK}, // IPv4-mapped
+		{"10.1.2.3", http.StatusOK},               // no port
+		{"", http.StatusForbidden},
+		{"garbage", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("RemoteAddr %q: expected status %d, got %d", test.remoteAddr, test.code, w.Code)
+		}
+	}
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	router := New()
+	router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(IPFilter(nil, []string{"203.0.113.0/24"}))
+
+	for addr, code := range map[string]int{
+		"198.51.100.1:80": http.StatusOK,
+		"203.0.113.9:80":  http.StatusForbidden,
+		"garbage":         http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		router.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("RemoteAddr %q: expected status %d, got %d", addr, code, w.Code)
+		}
+	}
+}
+
+func TestIPFilterProxies(t *testing.T) {
+	router := New()
+	router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(IPFilterProxies(nil, []string{"203.0.113.0/24"}, []string{"10.0.0.0/8"}))
+
+	tests := []struct {
+		remoteAddr string
+		xff        []string
+		code       int
+	}{
+		// Forwarded by a trusted proxy
+		{"10.0.0.1:80", []string{"203.0.113.9"}, http.StatusForbidden},
+		{"10.0.0.1:80", []string{"198.51.100.1"}, http.StatusOK},
+		{"10.0.0.1:80", []string{"203.0.113.9, 10.0.0.2"}, http.StatusForbidden},
+		{"10.0.0.1:80", []string{"203.0.113.9", "10.0.0.2"}, http.StatusForbidden},
+		// A spoofed first hop is ignored
+		{"10.0.0.1:80", []string{"203.0.113.9, 198.51.100.1"}, http.StatusOK},
+		{"10.0.0.1:80", []string{"198.51.100.1, 203.0.113.9"}, http.StatusForbidden},
+		{"10.0.0.1:80", []string{"garbage"}, http.StatusForbidden},
+		{"10.0.0.1:80", nil, http.StatusOK},
+		// The header of untrusted clients is ignored
+		{"203.0.113.9:80", []string{"198.51.100.1"}, http.StatusForbidden},
+		{"198.51.100.1:80", []string{"203.0.113.9"}, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, xff := range test.xff {
+			r.Header.Add("X-Forwarded-For", xff)
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("RemoteAddr %q, X-Forwarded-For %q: expected status %d, got %d",
+				test.remoteAddr, test.xff, test.code, w.Code)
+		}
+	}
+}
+
+func TestIPFilterInvalid(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0"} {
+		recv := catchPanic(func() {
+			IPFilter([]string{entry}, nil)
+		})
+		if recv == nil {
+			t.Errorf("no panic for invalid entry %q", entry)
+		}
+	}
+}
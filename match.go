@@ -0,0 +1,121 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "strings"
+
+// MatchPattern matches a single route pattern against the path, without
+// registering a route, e.g. to validate or preview patterns in tools.
+// It reports whether the path matches and returns the captured params.
+// Named (:param), blank (_) and catch-all (*catchall) parameters match like
+// they do in a Router, including their length limits, arities and default
+// values, but trailing slash redirects don't apply.
+// The path is expected to be escaped like a request path. The param values are
+// unescaped like in a Router; a value with an invalid escape sequence does not
+// match, like with StrictUnescape.
+// MatchPattern panics if the pattern is invalid.
+func MatchPattern(pattern, path string) (Params, bool) {
+	if len(pattern) < 1 || pattern[0] != '/' {
+		panic("path must begin with '/' in path '" + pattern + "'")
+	}
+	var defaults Params
+	if strings.IndexByte(pattern, '=') >= 0 {
+		pattern, defaults = parseParamDefaults(pattern)
+	}
+	pattern, limits := parseParamLimits(pattern)
+	pattern = translateBlank(pattern)
+
+	if ps, ok := matchPattern(pattern, path, limits); ok {
+		return ps, true
+	}
+
+	// Paths omitting params with default values, see Router.handleDefaults
+	short := pattern
+	for i := len(defaults) - 1; i >= 0; i-- {
+		short = short[:strings.LastIndexByte(short, '/')]
+		shortPattern := short
+		if shortPattern == "" {
+			shortPattern = "/"
+		}
+		if ps, ok := matchPattern(shortPattern, path, limits); ok {
+			return append(ps, defaults[i:]...), true
+		}
+	}
+	return nil, false
+}
+
+// matchPattern matches the pattern, whose length limits and arities are
+// stripped, against the path.
+func matchPattern(pattern, path string, limits []paramLimit) (Params, bool) {
+	var ps Params
+	for {
+		wildcard, i, valid := findWildcard(pattern)
+		if i < 0 {
+			return ps, pattern == path
+		}
+		if !valid {
+			panic("only one wildcard per path segment is allowed, has: '" +
+				wildcard + "' in path '" + pattern + "'")
+		}
+		if len(wildcard) < 2 {
+			panic("wildcards must be named with a non-empty name in path '" + pattern + "'")
+		}
+
+		if wildcard[0] == '*' {
+			if i+len(wildcard) != len(pattern) {
+				panic("catch-all routes are only allowed at the end of the path in path '" + pattern + "'")
+			}
+			if pattern[i-1] != '/' {
+				panic("no / before catch-all in path '" + pattern + "'")
+			}
+			// The catch-all includes the '/' before it
+			i--
+			if len(path) <= i || path[:i] != pattern[:i] || path[i] != '/' {
+				return nil, false
+			}
+			value, err := pathUnescape(path[i:], false)
+			if err != nil {
+				return nil, false
+			}
+			return append(ps, Param{Key: wildcard[1:], Value: value}), true
+		}
+
+		// Static part before the param
+		if !strings.HasPrefix(path, pattern[:i]) {
+			return nil, false
+		}
+		path = path[i:]
+
+		// The param matches until the next '/' or the path end
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		// Check the segment like the param node in a tree would
+		param := node{}
+		for _, limit := range limits {
+			if limit.wildcard == wildcard {
+				if limit.max > 0 {
+					param.maxLen = limit.max
+				}
+				if limit.arity > 0 {
+					param.arity = limit.arity
+				}
+			}
+		}
+		if param.rejects(path[:end], 0) {
+			return nil, false
+		}
+		value, err := pathUnescape(path[:end], false)
+		if err != nil {
+			return nil, false
+		}
+		if wildcard[1:] != blankParam {
+			ps = append(ps, Param{Key: wildcard[1:], Value: value})
+		}
+		path = path[end:]
+		pattern = pattern[i+len(wildcard):]
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+		ps      Params
+	}{
+		{"/", "/", true, nil},
+		{"/users", "/users", true, nil},
+		{"/users", "/users/", false, nil},
+		{"/users/:id", "/users/42", true, Params{{"id", "42"}}},
+		{"/users/:id", "/users/", false, nil},
+		{"/users/:id", "/users/42/", false, nil},
+		{"/users/:id/posts/:post", "/users/42/posts/7", true, Params{{"id", "42"}, {"post", "7"}}},
+		{"/users/:id/posts/:post", "/users/42/comments/7", false, nil},
+		{"/data.:format", "/data.json", true, Params{{"format", "json"}}},
+		{"/data.:format", "/data.", false, nil},
+		{"/files/*filepath", "/files/", true, Params{{"filepath", "/"}}},
+		{"/files/*filepath", "/files/css/app.css", true, Params{{"filepath", "/css/app.css"}}},
+		{"/files/*filepath", "/files", false, nil},
+		{"/src/:repo/*filepath", "/src/httprouter/tree.go", true, Params{{"repo", "httprouter"}, {"filepath", "/tree.go"}}},
+		{"/src/:repo/*filepath", "/src/httprouter", false, nil},
+		{"/*all", "/anything/at/all", true, Params{{"all", "/anything/at/all"}}},
+		{"/a/_/c", "/a/x/c", true, nil},
+		{"/a/_/c", "/a/c", false, nil},
+		{"/a/_/:id", "/a/x/42", true, Params{{"id", "42"}}},
+		{"/u/:id{max=2}", "/u/12", true, Params{{"id", "12"}}},
+		{"/u/:id{max=2}", "/u/123", false, nil},
+		{"/p/:pt[2]", "/p/1,2", true, Params{{"pt", "1,2"}}},
+		{"/p/:pt[2]", "/p/1,2,3", false, nil},
+		{"/list/:page=1", "/list/3", true, Params{{"page", "3"}}},
+		{"/list/:page=1", "/list", true, Params{{"page", "1"}}},
+		{"/list/:page=1{max=2}", "/list/123", false, nil},
+		{"/u/:name", "/u/x%20y", true, Params{{"name", "x y"}}},
+		{"/u/:name", "/u/a+b%2Fc", true, Params{{"name", "a+b/c"}}},
+		{"/u/:name", "/u/x%2", false, nil},
+		{"/files/*filepath", "/files/a%20b/c", true, Params{{"filepath", "/a b/c"}}},
+	}
+	for _, test := range tests {
+		ps, match := MatchPattern(test.pattern, test.path)
+		if match != test.match {
+			t.Errorf("%s %s: want match %v, got %v", test.pattern, test.path, test.match, match)
+		}
+		if match && !reflect.DeepEqual(ps, test.ps) {
+			t.Errorf("%s %s: wrong params: want %v, got %v", test.pattern, test.path, test.ps, ps)
+		}
+	}
+}
+
+func TestMatchPatternInvalid(t *testing.T) {
+	patterns := []string{
+		"users/:id",
+		"/users/:",
+		"/users/:id:name",
+		"/files/*filepath/more",
+		"/files*filepath",
+	}
+	for _, pattern := range patterns {
+		if recv := catchPanic(func() { MatchPattern(pattern, "/") }); recv == nil {
+			t.Errorf("no panic for invalid pattern %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Merge returns a new router with the routes of all given routers, e.g. of
+// modules which build their routers separately. The routes keep their options,
+// like query restrictions, param limits and priorities, and whether they are
+// disabled. Prefixes registered with PrefixMatch are merged as well.
+// The merged router has the configuration returned by New. The middleware of
+// the given routers is dropped, see MergeWithMiddleware, as are their NotFound
+// and other handlers and options.
+// If routes of different routers conflict, no router is returned, but an error
+// of type RouteErrors naming the conflicting routes.
+func Merge(routers ...*Router) (*Router, error) {
+	return merge(routers, false)
+}
+
+// MergeWithMiddleware is like Merge, but the routes keep the middleware of
+// their router as it was at the time of the merge. It runs inside the
+// middleware added to the merged router.
+func MergeWithMiddleware(routers ...*Router) (*Router, error) {
+	return merge(routers, true)
+}
+
+func merge(routers []*Router, keepMiddleware bool) (*Router, error) {
+	merged := New()
+	var errs RouteErrors
+	for _, src := range routers {
+		var mws *middlewareStack
+		if keepMiddleware {
+			mws = src.middleware()
+		}
+		wrap := func(pattern string, handle Handle) Handle {
+			if mws == nil {
+				return handle
+			}
+			return func(w http.ResponseWriter, req *http.Request, ps Params) {
+				mws.apply(req.Method, pattern, handle)(w, req, ps)
+			}
+		}
+
+		if route := src.serverOPTIONS; route != nil {
+			if _, err := merged.TryHandle(http.MethodOptions, "*", wrap("*", route.handle)); err != nil {
+				errs = append(errs, err.(*RouteError))
+			}
+		}
+
+		methods := make([]string, 0, len(src.routes))
+		for method := range src.routes {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			paths := make([]string, 0, len(src.routes[method]))
+			for path := range src.routes[method] {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			for _, path := range paths {
+				if err := merged.mergeRoute(src, method, path, wrap); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+
+		for _, p := range src.prefixes {
+			if err := merged.mergePrefix(p.prefix, wrap(p.prefix, p.handle)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return merged, nil
+}
+
+// mergeRoute registers the group of routes of src for the method and path.
+func (r *Router) mergeRoute(src *Router, method, path string, wrap func(string, Handle) Handle) *RouteError {
+	first := src.routes[method][path]
+	limited := limitedPath(src.trees[method], path)
+	for _, route := range first.group {
+		rt, err := r.TryHandle(method, limited, wrap(path, route.handle))
+		if err != nil {
+			return err.(*RouteError)
+		}
+		rt.query = route.query
+		rt.queryKeys = route.queryKeys
+		rt.validators = route.validators
+		rt.push = route.push
+		rt.consumes = route.consumes
+		rt.produces = route.produces
+		rt.cacheControl = route.cacheControl
+		rt.label = route.label
+		if route.priority != 0 {
+			rt.Priority(route.priority)
+		}
+	}
+
+	group := r.routes[method][path]
+	if first.exact {
+		group.exact = true
+		r.hasExact = true
+	}
+	atomic.StoreInt32(&group.disabled, atomic.LoadInt32(&first.disabled))
+	return nil
+}
+
+// mergePrefix registers the prefix like PrefixMatch, but returns an error
+// instead of panicking if it is already registered.
+func (r *Router) mergePrefix(prefix string, handle Handle) (err *RouteError) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = &RouteError{
+				Method: methodAny,
+				Path:   prefix,
+				Err:    fmt.Errorf("%v", rcv),
+			}
+		}
+	}()
+	r.PrefixMatch(prefix, handle)
+	return nil
+}
+
+// limitedPath returns the path with the length limits and arities of its
+// params in the tree appended, e.g. /users/:id{max=36}, so that registering it
+// again restores them.
+func limitedPath(root *node, path string) string {
+	if root == nil || !strings.Contains(path, ":") {
+		return path
+	}
+
+	var buf bytes.Buffer
+	rest := path
+	for {
+		i := strings.IndexByte(rest, ':')
+		if i < 0 {
+			buf.WriteString(rest)
+			return buf.String()
+		}
+		end := strings.IndexByte(rest[i:], '/')
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += i
+		}
+		wildcard := rest[i:end]
+		buf.WriteString(rest[:end])
+		if n := root.wildcardNode(path, wildcard); n != nil {
+			if n.maxLen > 0 {
+				buf.WriteString("{max=" + strconv.Itoa(n.maxLen) + "}")
+			}
+			if n.arity > 0 {
+				buf.WriteString("[" + strconv.Itoa(n.arity) + "]")
+			}
+		}
+		rest = rest[end:]
+	}
+}
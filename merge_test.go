@@ -0,0 +1,119 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("id")
+		}
+	}
+
+	users := New()
+	users.GET("/users/:id{max=3}", handle("user"))
+	users.GET("/rpc", handle("delete")).Query("action", "delete")
+	users.GET("/rpc", handle("rpc"))
+	users.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			w.Header().Set("X-Users", "1")
+			next(w, req, ps)
+		}
+	})
+
+	orders := New()
+	orders.GET("/orders/:id", handle("order"))
+	orders.POST("/orders", handle("create"))
+	orders.Any("/health", handle("health"))
+	orders.GET("/point/:id[2]", handle("point"))
+	orders.GET("/old", handle("old"))
+	orders.Disable(http.MethodGet, "/old")
+	orders.PrefixMatch("/static-", handle("static"))
+
+	router, err := Merge(users, orders)
+	if err != nil {
+		t.Fatalf("merging failed: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+		routed string
+	}{
+		{http.MethodGet, "/users/7", http.StatusOK, "user7"},
+		{http.MethodGet, "/users/1234", http.StatusNotFound, ""}, // length limit
+		{http.MethodGet, "/rpc?action=delete", http.StatusOK, "delete"},
+		{http.MethodGet, "/rpc", http.StatusOK, "rpc"},
+		{http.MethodGet, "/orders/8", http.StatusOK, "order8"},
+		{http.MethodPost, "/orders", http.StatusOK, "create"},
+		{http.MethodPut, "/health", http.StatusOK, "health"},
+		{http.MethodGet, "/point/1,2", http.StatusOK, "point1,2"},
+		{http.MethodGet, "/point/1", http.StatusNotFound, ""}, // arity
+		{http.MethodGet, "/old", http.StatusServiceUnavailable, ""},
+		{http.MethodGet, "/static-abc", http.StatusOK, "static"},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.route, nil))
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s %s: want %d %q, got %d %q", test.method, test.route, test.code, test.routed, w.Code, routed)
+		}
+		if w.Header().Get("X-Users") != "" {
+			t.Errorf("%s %s: middleware of the source router was applied", test.method, test.route)
+		}
+	}
+
+	// the middleware is kept on request
+	router, err = MergeWithMiddleware(users, orders)
+	if err != nil {
+		t.Fatalf("merging with middleware failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	if w.Header().Get("X-Users") != "1" {
+		t.Error("middleware of the users router was not applied")
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/8", nil))
+	if w.Header().Get("X-Users") != "" {
+		t.Error("middleware of the users router was applied to an orders route")
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	a := New()
+	a.GET("/users/:id", handlerFunc)
+	a.GET("/health", handlerFunc)
+	b := New()
+	b.GET("/users/:name", handlerFunc)
+	b.GET("/health", handlerFunc)
+	b.POST("/health", handlerFunc)
+
+	router, err := Merge(a, b)
+	if router != nil {
+		t.Error("router returned despite conflicts")
+	}
+	errs, ok := err.(RouteErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("want RouteErrors with 2 errors, got %v", err)
+	}
+	if errs[0].Method != http.MethodGet || errs[0].Path != "/health" {
+		t.Errorf("want conflict for GET /health, got %s %s", errs[0].Method, errs[0].Path)
+	}
+	if errs[1].Path != "/users/:name" || !strings.Contains(errs[1].Error(), "/users/:id") {
+		t.Errorf("want conflict of /users/:name with /users/:id, got %v", errs[1])
+	}
+}
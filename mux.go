@@ -0,0 +1,139 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PrefixMux is a http.Handler which dispatches requests to different routers
+// based on the prefix of the request path, e.g. to combine the routers of
+// several services into one handler.
+// The longest matching prefix is chosen and stripped from the request path
+// before the request is passed on, so that the routers register their routes
+// relative to their prefix.
+// Prefixes are matched at segment boundaries: the prefix /a matches the paths
+// /a and /a/users, but not /ab.
+type PrefixMux struct {
+	prefixes []muxPrefix
+
+	// Configurable http.Handler which is called when no prefix matches.
+	// If it is not set, http.NotFound is used.
+	NotFound http.Handler
+}
+
+type muxPrefix struct {
+	prefix string
+	router *Router
+}
+
+// NewPrefixMux returns a new PrefixMux dispatching to the routers, which are
+// keyed by their path prefix, e.g. "/billing". The prefix "/" matches all
+// paths, which are passed on unchanged.
+func NewPrefixMux(routers map[string]*Router) *PrefixMux {
+	mux := &PrefixMux{}
+	for prefix, router := range routers {
+		if len(prefix) < 1 || prefix[0] != '/' {
+			panic("prefix must begin with '/' in prefix '" + prefix + "'")
+		}
+		if router == nil {
+			panic("router must not be nil for prefix '" + prefix + "'")
+		}
+		trimmed := strings.TrimSuffix(prefix, "/")
+		for _, p := range mux.prefixes {
+			if p.prefix == trimmed {
+				panic("a router is already registered for prefix '" + prefix + "'")
+			}
+		}
+
+		// Keep the prefixes sorted by length, longest first
+		i := len(mux.prefixes)
+		for i > 0 && len(mux.prefixes[i-1].prefix) < len(trimmed) {
+			i--
+		}
+		mux.prefixes = append(mux.prefixes, muxPrefix{})
+		copy(mux.prefixes[i+1:], mux.prefixes[i:])
+		mux.prefixes[i] = muxPrefix{trimmed, router}
+	}
+	return mux
+}
+
+// ServeHTTP makes the prefix mux implement the http.Handler interface.
+func (mux *PrefixMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := requestPath(req)
+	for _, p := range mux.prefixes {
+		if strings.HasPrefix(path, p.prefix) &&
+			(len(path) == len(p.prefix) || path[len(p.prefix)] == '/') {
+			p.router.ServeHTTP(w, stripPrefix(req, p.prefix))
+			return
+		}
+	}
+
+	if mux.NotFound != nil {
+		mux.NotFound.ServeHTTP(w, req)
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+// stripPrefix returns a shallow copy of the request with the prefix removed
+// from the request URI and the URL path.
+func stripPrefix(req *http.Request, prefix string) *http.Request {
+	if prefix == "" {
+		return req
+	}
+	strip := func(path string) string {
+		path = strings.TrimPrefix(path, prefix)
+		if path == "" || path[0] != '/' {
+			path = "/" + path
+		}
+		return path
+	}
+
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+	r2.URL.Path = strip(req.URL.Path)
+	if req.URL.RawPath != "" {
+		r2.URL.RawPath = strip(req.URL.RawPath)
+	}
+	path := requestPath(req)
+	r2.RequestURI = strip(path) + req.RequestURI[len(path):]
+	return r2
+}
+
+// mountRequest returns a shallow copy of the request with the path reduced to
+// the part starting at the depth-th '/' of the raw path, whose unescaped form
+// is rest.
+func mountRequest(req *http.Request, depth int, rest string) *http.Request {
+	path := requestPath(req)
+	start := 0
+	for n := 0; start < len(path); start++ {
+		if path[start] == '/' {
+			if n++; n == depth {
+				break
+			}
+		}
+	}
+	rawRest := path[start:]
+	if rawRest == "" {
+		rawRest = "/"
+	}
+
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+	r2.URL.Path = rest
+	r2.URL.RawPath = ""
+	if rawRest != rest {
+		r2.URL.RawPath = rawRest
+	}
+	r2.RequestURI = rawRest + req.RequestURI[len(path):]
+	return r2
+}
@@ -0,0 +1,148 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrefixMux(t *testing.T) {
+	var routed, path string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, req *http.Request, ps Params) {
+			routed = name
+			path = req.URL.Path
+		}
+	}
+
+	a := New()
+	a.GET("/", handle("a"))
+	a.GET("/users/:id", handle("a"))
+	ab := New()
+	ab.GET("/users/:id", handle("ab"))
+
+	mux := NewPrefixMux(map[string]*Router{
+		"/a":   a,
+		"/ab/": ab,
+	})
+
+	tests := []struct {
+		route  string
+		routed string
+		path   string
+	}{
+		{"/a/users/1", "a", "/users/1"},
+		{"/ab/users/2", "ab", "/users/2"},
+		{"/ab/users/3?x=1", "ab", "/users/3"},
+		{"/a", "a", "/"},
+		{"/abc/users/4", "", ""},
+		{"/b/users/5", "", ""},
+	}
+	for _, test := range tests {
+		routed, path = "", ""
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+		if routed != test.routed {
+			t.Errorf("%s: want router %q, got %q", test.route, test.routed, routed)
+		}
+		if path != test.path {
+			t.Errorf("%s: want stripped path %q, got %q", test.route, test.path, path)
+		}
+		if test.routed == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", test.route, w.Code)
+		}
+	}
+}
+
+func TestPrefixMuxRoot(t *testing.T) {
+	var routed string
+	root := New()
+	root.GET("/b/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "root"
+	})
+	a := New()
+	a.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "a"
+	})
+
+	mux := NewPrefixMux(map[string]*Router{"/": root, "/a": a})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/b/users/1", nil))
+	if routed != "root" {
+		t.Errorf("want root router, got %q", routed)
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/users/1", nil))
+	if routed != "a" {
+		t.Errorf("want router a, got %q", routed)
+	}
+}
+
+func TestPrefixMuxInvalid(t *testing.T) {
+	recv := catchPanic(func() {
+		NewPrefixMux(map[string]*Router{"a": New()})
+	})
+	if recv == nil {
+		t.Error("no panic for prefix without leading slash")
+	}
+	recv = catchPanic(func() {
+		NewPrefixMux(map[string]*Router{"/a": New(), "/a/": New()})
+	})
+	if recv == nil {
+		t.Error("no panic for duplicate prefix")
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	var tenant, path, requestURI string
+	sub := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		tenant = ParamsFromContext(req.Context()).ByName("t")
+		path = req.URL.Path
+		requestURI = req.RequestURI
+	})
+
+	router := New()
+	router.Mount("/tenant/:t/*rest", sub)
+
+	tests := []struct {
+		route      string
+		tenant     string
+		path       string
+		requestURI string
+	}{
+		{"/tenant/acme/users/7", "acme", "/users/7", "/users/7"},
+		{"/tenant/acme/", "acme", "/", "/"},
+		{"/tenant/acme/users?page=2", "acme", "/users", "/users?page=2"},
+		{"/tenant/a%20b/files/x%2Fy", "a b", "/files/x/y", "/files/x%2Fy"},
+	}
+	for _, test := range tests {
+		tenant, path, requestURI = "", "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.route, nil))
+		if tenant != test.tenant || path != test.path || requestURI != test.requestURI {
+			t.Errorf("%s: want t=%q path %q uri %q, got t=%q path %q uri %q",
+				test.route, test.tenant, test.path, test.requestURI, tenant, path, requestURI)
+		}
+	}
+
+	// a mounted router routes by the stripped path
+	var user string
+	app := New()
+	app.GET("/users/:id", func(_ http.ResponseWriter, req *http.Request, ps Params) {
+		user = ps.ByName("id")
+	})
+	router.Mount("/apps/:t/*rest", app)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/apps/acme/users/42", nil))
+	if w.Code != http.StatusOK || user != "42" {
+		t.Errorf("mounted router: want 200 with user 42, got %d with user %q", w.Code, user)
+	}
+
+	for _, path := range []string{"/tenant/:t", "/tenant/:t/*rest/x", "/tenant/*rest/"} {
+		if recv := catchPanic(func() { New().Mount(path, sub) }); recv == nil {
+			t.Errorf("mounting under %s did not panic", path)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type negotiatedTypeKey struct{}
+
+// NegotiatedTypeFromContext returns the media type chosen by the Accepts
+// middleware, or an empty string if none was negotiated.
+func NegotiatedTypeFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(negotiatedTypeKey{}).(string)
+	return t
+}
+
+// Accepts returns a middleware which negotiates the response media type with
+// the client's Accept header. The given types are the media types the handle
+// can produce, in order of preference.
+// If none of them is acceptable, the request is answered with status code 406
+// and the handle is not called. Otherwise the chosen type is stored in the
+// request context and can be retrieved with NegotiatedTypeFromContext.
+// Wildcards like */* and text/* as well as quality values are supported.
+// A request without an Accept header accepts any type.
+func Accepts(types ...string) func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			chosen := negotiate(req.Header.Get("Accept"), types)
+			if chosen == "" {
+				http.Error(w,
+					http.StatusText(http.StatusNotAcceptable),
+					http.StatusNotAcceptable,
+				)
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), negotiatedTypeKey{}, chosen)
+			next(w, req.WithContext(ctx), ps)
+		}
+	}
+}
+
+// negotiate returns the offered type with the highest quality value according
+// to the given Accept header. Ties are broken by the order of the offers.
+func negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// The quality value of the most specific matching media range applies
+		q, specificity := 0.0, -1
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mt, mq := parseMediaRange(mediaRange)
+			if s := matchMediaType(mt, offer); s > specificity {
+				q, specificity = mq, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// parseMediaRange splits a single Accept header element into its media type
+// and its quality value.
+func parseMediaRange(s string) (mediaType string, q float64) {
+	q = 1
+	params := strings.Split(s, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(params[0]))
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return
+}
+
+// matchMediaType reports how specifically the media range matches the offered
+// type: 2 for an exact match, 1 for type/*, 0 for */* and -1 for no match.
+func matchMediaType(mediaRange, offer string) int {
+	offer = strings.ToLower(offer)
+	switch {
+	case mediaRange == offer:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") &&
+		strings.HasPrefix(offer, mediaRange[:len(mediaRange)-1]):
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccepts(t *testing.T) {
+	var negotiated string
+	router := New()
+	router.GET("/data", Accepts("application/json", "text/html")(
+		func(_ http.ResponseWriter, r *http.Request, _ Params) {
+			negotiated = NegotiatedTypeFromContext(r.Context())
+		},
+	))
+
+	tests := []struct {
+		accept string
+		code   int
+		chosen string
+	}{
+		{"application/json", http.StatusOK, "application/json"},
+		{"text/html, application/json;q=0.9", http.StatusOK, "text/html"},
+		{"*/*", http.StatusOK, "application/json"},
+		{"text/*", http.StatusOK, "text/html"},
+		{"*/*;q=0.1, text/html;q=0.5", http.StatusOK, "text/html"},
+		{"application/json;q=0, */*", http.StatusOK, "text/html"},
+		{"", http.StatusOK, "application/json"},
+		{"image/png", http.StatusNotAcceptable, ""},
+		{"text/plain, image/*", http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		negotiated = ""
+		r := httptest.NewRequest(http.MethodGet, "/data", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Accept %q: wrong status code: want %d, got %d", test.accept, test.code, w.Code)
+		}
+		if negotiated != test.chosen {
+			t.Errorf("Accept %q: wrong negotiated type: want %q, got %q", test.accept, test.chosen, negotiated)
+		}
+	}
+}
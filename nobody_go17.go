@@ -0,0 +1,16 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build !go1.8
+// +build !go1.8
+
+package httprouter
+
+import "io"
+
+// isNoBody reports whether the request body is known to be empty. Before Go
+// 1.8, which added http.NoBody, only a nil body is.
+func isNoBody(body io.ReadCloser) bool {
+	return body == nil
+}
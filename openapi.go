@@ -0,0 +1,99 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// openAPIMethods maps the methods supported by OpenAPI to their keys in a path
+// item object.
+var openAPIMethods = map[string]string{
+	http.MethodGet:     "get",
+	http.MethodPut:     "put",
+	http.MethodPost:    "post",
+	http.MethodDelete:  "delete",
+	http.MethodOptions: "options",
+	http.MethodHead:    "head",
+	http.MethodPatch:   "patch",
+	http.MethodTrace:   "trace",
+}
+
+// OpenAPIPaths returns the registered routes in the shape of the paths object
+// of an OpenAPI specification, e.g. to fold them into a spec generator.
+// Paths are keyed by their OpenAPI template, where :name parameters are
+// converted to {name}, and map the lowercase method names to operation
+// objects. The operation objects only list the path parameters, which are
+// required and of type string.
+//
+// OpenAPI path parameters can not span multiple segments. By convention, a
+// catch-all parameter *name is converted to {name} as well, with its
+// parameter marked by the extension "x-catch-all": true.
+//
+// Since every template expression needs a parameter, blank segments (_),
+// which match any one segment without capturing it, are converted to {_1},
+// {_2} and so on, in order of their occurrence in the path. Their parameters
+// are marked by the extension "x-blank": true.
+//
+// Routes registered with Any or for methods not supported by OpenAPI are
+// omitted. The result is derived from the registered routes and safe to
+// modify.
+func (r *Router) OpenAPIPaths() map[string]map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	for method, routes := range r.routes {
+		key, ok := openAPIMethods[method]
+		if !ok {
+			continue
+		}
+		for path := range routes {
+			template, params := openAPIPath(path)
+			item := paths[template]
+			if item == nil {
+				item = make(map[string]interface{})
+				paths[template] = item
+			}
+			item[key] = map[string]interface{}{
+				"parameters": params,
+			}
+		}
+	}
+	return paths
+}
+
+// openAPIPath converts the route path to an OpenAPI path template and returns
+// the parameter objects of its path parameters.
+func openAPIPath(path string) (string, []interface{}) {
+	params := []interface{}{}
+	blanks := 0
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if len(seg) < 2 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		name := seg[1:]
+		blank := seg[0] == ':' && name == blankParam
+		if blank {
+			blanks++
+			name = blankParam + strconv.Itoa(blanks)
+		}
+		param := map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		}
+		if seg[0] == '*' {
+			param["x-catch-all"] = true
+		}
+		if blank {
+			param["x-blank"] = true
+		}
+		params = append(params, param)
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
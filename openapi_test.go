@@ -0,0 +1,74 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouterOpenAPIPaths(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:id", handlerFunc)
+	router.DELETE("/user/:id", handlerFunc)
+	router.POST("/user", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+	router.GET("/a/_/c/_", handlerFunc)
+	router.Any("/proxy", handlerFunc)
+	router.Handle("PROPFIND", "/dav", handlerFunc)
+
+	paths := router.OpenAPIPaths()
+
+	idParam := map[string]interface{}{
+		"name":     "id",
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+	want := map[string]map[string]interface{}{
+		"/user/{id}": {
+			"get":    map[string]interface{}{"parameters": []interface{}{idParam}},
+			"delete": map[string]interface{}{"parameters": []interface{}{idParam}},
+		},
+		"/user": {
+			"post": map[string]interface{}{"parameters": []interface{}{}},
+		},
+		"/src/{filepath}": {
+			"get": map[string]interface{}{"parameters": []interface{}{
+				map[string]interface{}{
+					"name":        "filepath",
+					"in":          "path",
+					"required":    true,
+					"schema":      map[string]interface{}{"type": "string"},
+					"x-catch-all": true,
+				},
+			}},
+		},
+		"/a/{_1}/c/{_2}": {
+			"get": map[string]interface{}{"parameters": []interface{}{
+				map[string]interface{}{
+					"name":     "_1",
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+					"x-blank":  true,
+				},
+				map[string]interface{}{
+					"name":     "_2",
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+					"x-blank":  true,
+				},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("wrong OpenAPI paths:\nwant %v\ngot  %v", want, paths)
+	}
+}
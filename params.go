@@ -0,0 +1,129 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrParamNotFound is wrapped by the errors of the typed Params accessors if
+// the requested Param does not exist.
+var ErrParamNotFound = errors.New("param not found")
+
+// ParamError describes why a Param could not be converted by one of the typed
+// Params accessors.
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return "param '" + e.Name + "': " + e.Err.Error()
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// The typed accessors below are conveniences over Get. They only convert
+// values of matched routes and do not affect routing, i.e. a route with an
+// invalid value is matched nonetheless. See Route.Validate for this.
+
+// Int returns the value of the first Param with the given name as an int.
+// The error is of type *ParamError.
+func (ps Params) Int(name string) (int, error) {
+	v, err := ps.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: v, Err: err}
+	}
+	return n, nil
+}
+
+// Int64 returns the value of the first Param with the given name as an int64.
+// The error is of type *ParamError.
+func (ps Params) Int64(name string) (int64, error) {
+	v, err := ps.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: v, Err: err}
+	}
+	return n, nil
+}
+
+// Bool returns the value of the first Param with the given name as a bool.
+// It accepts the values accepted by strconv.ParseBool, e.g. "1", "true" and
+// "false". The error is of type *ParamError.
+func (ps Params) Bool(name string) (bool, error) {
+	v, err := ps.lookup(name)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &ParamError{Name: name, Value: v, Err: err}
+	}
+	return b, nil
+}
+
+// UUID returns the value of the first Param with the given name as a UUID in
+// its 16 byte representation. The value must be in the canonical textual form
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, hex digits may be upper or lower case.
+// The error is of type *ParamError.
+func (ps Params) UUID(name string) ([16]byte, error) {
+	var uuid [16]byte
+	v, err := ps.lookup(name)
+	if err != nil {
+		return uuid, err
+	}
+	if len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return uuid, &ParamError{Name: name, Value: v, Err: errInvalidUUID}
+	}
+	for i, j := 0, 0; i < len(v); j++ {
+		if v[i] == '-' {
+			i++
+		}
+		if !ishex(v[i]) || !ishex(v[i+1]) {
+			return [16]byte{}, &ParamError{Name: name, Value: v, Err: errInvalidUUID}
+		}
+		uuid[j] = unhex(v[i])<<4 | unhex(v[i+1])
+		i += 2
+	}
+	return uuid, nil
+}
+
+var errInvalidUUID = errors.New("invalid UUID")
+
+// Split returns the value of the first Param with the given name split at each
+// occurrence of sep, e.g. the values 12 and 34 of the path segment 12,34.
+// If no Param with the name exists or its value is empty, nil is returned.
+// To only match path segments with a fixed number of comma separated values,
+// declare the arity of the param in the route path, e.g. /point/:coords[2].
+func (ps Params) Split(name, sep string) []string {
+	value := ps.ByName(name)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, sep)
+}
+
+// lookup returns the value of the first Param with the given name, or an
+// error wrapping ErrParamNotFound.
+func (ps Params) lookup(name string) (string, error) {
+	v, ok := ps.Get(name)
+	if !ok {
+		return "", &ParamError{Name: name, Err: ErrParamNotFound}
+	}
+	return v, nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.23
+
+package httprouter
+
+import "iter"
+
+// All returns an iterator over the key-value pairs of the Params, in the order
+// of the parameters in the URL path.
+// Unlike building a map, iterating does not allocate:
+//
+//	for key, value := range ps.All() {
+//	    ...
+//	}
+func (ps Params) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, p := range ps {
+			if !yield(p.Key, p.Value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.23
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParamsAll(t *testing.T) {
+	var keys, values []string
+
+	router := New()
+	router.GET("/:a/:b/*c", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		for k, v := range ps.All() {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/x/y/z", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("wrong keys: want %v, got %v", want, keys)
+	}
+	if want := []string{"x", "y", "/z"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("wrong values: want %v, got %v", want, values)
+	}
+
+	// stop early
+	ps := Params{{"a", "1"}, {"b", "2"}}
+	n := 0
+	for range ps.All() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("iteration did not stop: %d iterations", n)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParamsTyped(t *testing.T) {
+	ps := Params{
+		{"id", "42"},
+		{"big", "9007199254740993"},
+		{"neg", "-7"},
+		{"flag", "true"},
+		{"uuid", "123e4567-E89B-12d3-a456-426614174000"},
+		{"bad", "x1"},
+		{"baduuid", "123e4567-e89b-12d3-a456-42661417400g"},
+	}
+
+	if n, err := ps.Int("id"); err != nil || n != 42 {
+		t.Errorf("Int(id): got %d, %v", n, err)
+	}
+	if n, err := ps.Int("neg"); err != nil || n != -7 {
+		t.Errorf("Int(neg): got %d, %v", n, err)
+	}
+	if n, err := ps.Int64("big"); err != nil || n != 9007199254740993 {
+		t.Errorf("Int64(big): got %d, %v", n, err)
+	}
+	if b, err := ps.Bool("flag"); err != nil || !b {
+		t.Errorf("Bool(flag): got %t, %v", b, err)
+	}
+	want := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	if u, err := ps.UUID("uuid"); err != nil || u != want {
+		t.Errorf("UUID(uuid): got %x, %v", u, err)
+	}
+
+	// invalid values
+	for _, err := range []error{
+		errOf(ps.Int("bad")),
+		errOf(ps.Int64("bad")),
+		errOf(ps.Bool("bad")),
+		errOf(ps.UUID("bad")),
+		errOf(ps.UUID("baduuid")),
+	} {
+		var pe *ParamError
+		if !errors.As(err, &pe) || pe.Value == "" {
+			t.Errorf("expected *ParamError with value, got %v", err)
+		}
+	}
+
+	// missing key
+	_, err := ps.Int("missing")
+	if !errors.Is(err, ErrParamNotFound) {
+		t.Errorf("expected ErrParamNotFound, got %v", err)
+	}
+	if msg := err.Error(); msg != "param 'missing': param not found" {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+}
+
+func errOf(_ interface{}, err error) error {
+	return err
+}
+
+func TestParamsSplit(t *testing.T) {
+	ps := Params{
+		{"coords", "12,34"},
+		{"tags", "a;b;c"},
+		{"empty", ""},
+	}
+
+	tests := []struct {
+		name, sep string
+		want      []string
+	}{
+		{"coords", ",", []string{"12", "34"}},
+		{"tags", ";", []string{"a", "b", "c"}},
+		{"tags", ",", []string{"a;b;c"}},
+		{"empty", ",", nil},
+		{"missing", ",", nil},
+	}
+	for _, test := range tests {
+		if got := ps.Split(test.name, test.sep); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Split(%q, %q): want %q, got %q", test.name, test.sep, test.want, got)
+		}
+	}
+}
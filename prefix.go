@@ -0,0 +1,72 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PrefixRestParam is the Param name under which the part of the request path
+// following the matched prefix is stored for handles registered with
+// PrefixMatch.
+var PrefixRestParam = "$prefixRest"
+
+type prefixRoute struct {
+	prefix string
+	handle Handle
+}
+
+// PrefixMatch registers a handle which matches all requests, regardless of
+// their method, whose path starts with the given prefix. Unlike a catch-all
+// parameter, the prefix does not need to end at a segment boundary, e.g. the
+// prefix "/static-" matches both /static-abc/app.js and /static-def/app.js.
+// The rest of the path following the prefix is passed to the handle under
+// PrefixRestParam.
+//
+// Routes registered with Handle (and Any) take precedence over prefix matches,
+// unless they have a negative priority, see Route.Priority. Prefixes are only
+// tried before the path auto-correction. If multiple prefixes match, the
+// longest one wins.
+func (r *Router) PrefixMatch(prefix string, handle Handle) {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+
+	// Keep the prefixes sorted by length, longest first
+	i := len(r.prefixes)
+	for j, p := range r.prefixes {
+		if p.prefix == prefix {
+			panic("a handle is already registered for prefix '" + prefix + "'")
+		}
+		if len(p.prefix) < len(prefix) && j < i {
+			i = j
+		}
+	}
+	r.prefixes = append(r.prefixes, prefixRoute{})
+	copy(r.prefixes[i+1:], r.prefixes[i:])
+	r.prefixes[i] = prefixRoute{prefix: prefix, handle: handle}
+}
+
+// matchPrefix returns the longest prefix the path starts with, or nil.
+func (r *Router) matchPrefix(path string) *prefixRoute {
+	for i := range r.prefixes {
+		if strings.HasPrefix(path, r.prefixes[i].prefix) {
+			return &r.prefixes[i]
+		}
+	}
+	return nil
+}
+
+// servePrefix serves the request with the handle of the matched prefix.
+func (r *Router) servePrefix(w http.ResponseWriter, req *http.Request, path string, p *prefixRoute) {
+	rest, _ := pathUnescape(path[len(p.prefix):], r.DecodePlusAsSpace)
+	ps := make(Params, 1, 2)
+	ps[0] = Param{Key: PrefixRestParam, Value: rest}
+	r.serveHandle(w, req, p.handle, p.prefix, &ps)
+}
@@ -0,0 +1,67 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterPrefixMatch(t *testing.T) {
+	var matched, rest string
+	prefixHandle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			matched = name
+			rest = ps.ByName(PrefixRestParam)
+		}
+	}
+
+	router := New()
+	router.PrefixMatch("/static-", prefixHandle("static"))
+	router.PrefixMatch("/static-v2/", prefixHandle("static-v2"))
+	router.GET("/static-abc/exact.js", prefixHandle("exact"))
+
+	tests := []struct {
+		method  string
+		path    string
+		matched string
+		rest    string
+	}{
+		{http.MethodGet, "/static-abc/app.js", "static", "abc/app.js"},
+		{http.MethodGet, "/static-def/app.js", "static", "def/app.js"},
+		{http.MethodHead, "/static-def/app%20v1.js", "static", "def/app v1.js"},
+		{http.MethodGet, "/static-v2/app.js", "static-v2", "app.js"},
+		{http.MethodGet, "/static-abc/exact.js", "exact", ""},
+	}
+	for _, test := range tests {
+		matched, rest = "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if matched != test.matched || rest != test.rest {
+			t.Errorf("%s %s: want %s with rest %q, got %s with rest %q",
+				test.method, test.path, test.matched, test.rest, matched, rest)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unmatched prefix, got %d", w.Code)
+	}
+
+	recv := catchPanic(func() {
+		router.PrefixMatch("/static-", prefixHandle("dup"))
+	})
+	if recv == nil {
+		t.Error("registering a duplicate prefix did not panic")
+	}
+	recv = catchPanic(func() {
+		router.PrefixMatch("static-", prefixHandle("invalid"))
+	})
+	if recv == nil {
+		t.Error("registering a prefix without leading slash did not panic")
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import "net/http"
+
+// push pushes the targets to the client, if the writer supports HTTP/2 server
+// push, see Route.Push.
+func push(w http.ResponseWriter, targets []string) {
+	if pusher, ok := w.(http.Pusher); ok {
+		for _, target := range targets {
+			pusher.Push(target, nil)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build !go1.8
+// +build !go1.8
+
+package httprouter
+
+import "net/http"
+
+// push is a no-op before Go 1.8, which added HTTP/2 server push.
+func push(w http.ResponseWriter, targets []string) {}
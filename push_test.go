@@ -0,0 +1,53 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestRoutePush(t *testing.T) {
+	var pushedBefore int
+	var w *pushRecorder
+
+	router := New()
+	router.GET("/page", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		pushedBefore = len(w.pushed)
+	}).Push("/style.css", "/app.js")
+
+	w = &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r := httptest.NewRequest(http.MethodGet, "/page", nil)
+	router.ServeHTTP(w, r)
+	if want := []string{"/style.css", "/app.js"}; !reflect.DeepEqual(w.pushed, want) {
+		t.Errorf("wrong pushed resources: want %v, got %v", want, w.pushed)
+	}
+	if pushedBefore != 2 {
+		t.Errorf("resources not pushed before handle was invoked")
+	}
+
+	// no-op without http.Pusher
+	rec := httptest.NewRecorder()
+	w = &pushRecorder{}
+	router.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("serving without push support failed: Code=%d", rec.Code)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+type requestIDKey struct{}
+
+// RequestIDKey is the request context key under which a request ID, a string,
+// may be stored, e.g. by a middleware assigning IDs to incoming requests.
+// RecovererJSON includes it in its error responses.
+var RequestIDKey = requestIDKey{}
+
+// RecovererJSON returns middleware which recovers from panics in the handle,
+// see Router.Use. The panic is logged with its stack trace and the request is
+// answered with status code 500 and the JSON body {"error":"internal"}. If a
+// request ID is stored in the request context under RequestIDKey, it is
+// included as "request_id".
+// Since the middleware recovers the panic before it leaves the handle, the
+// Router's PanicHandler and PanicHandler2 are not called for it. They still
+// handle panics outside of the middleware chain, e.g. in the NotFound handler
+// or in middleware added before RecovererJSON.
+// Panics with http.ErrAbortHandler, which exists since Go 1.8, are not
+// recovered, since they are used to abort the response on purpose.
+//
+//	router.Use(httprouter.RecovererJSON())
+func RecovererJSON() func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			defer func() {
+				rcv := recover()
+				if rcv == nil {
+					return
+				}
+				if isAbort(rcv) {
+					panic(rcv)
+				}
+				log.Printf("httprouter: panic serving %s %s: %v\n%s", req.Method, req.URL.Path, rcv, debug.Stack())
+
+				body := struct {
+					Error     string `json:"error"`
+					RequestID string `json:"request_id,omitempty"`
+				}{Error: "internal"}
+				body.RequestID, _ = req.Context().Value(RequestIDKey).(string)
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(body)
+			}()
+			next(w, req, ps)
+		}
+	}
+}
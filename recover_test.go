@@ -0,0 +1,68 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecovererJSON(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	router := New()
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {
+		t.Error("PanicHandler called for a recovered panic")
+	}
+	router.Use(RecovererJSON())
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops")
+	})
+	router.GET("/ok", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		requestID string
+		body      string
+	}{
+		{"", `{"error":"internal"}`},
+		{"abc-123", `{"error":"internal","request_id":"abc-123"}`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+		if test.requestID != "" {
+			r = r.WithContext(context.WithValue(r.Context(), RequestIDKey, test.requestID))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("want status 500, got %d", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("wrong Content-Type: %q", ct)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != test.body {
+			t.Errorf("wrong body: want %s, got %s", test.body, body)
+		}
+	}
+	if !strings.Contains(logged.String(), "oops") {
+		t.Errorf("panic not logged: %q", logged.String())
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("request without panic changed: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Route is a route registered with Router.Handle or one of its shortcut
+// functions. Its methods can be used to further configure the route and return
+// the Route itself, so that calls can be chained:
+//
+//	router.GET("/rpc", handle).Query("action", "delete")
+//
+// A Route must be configured before the router starts serving requests.
+type Route struct {
+	router *Router
+	method string
+	path   string
+	handle Handle
+
+	query      []queryParam
+	queryKeys  []string
+	validators []paramValidator
+	push       []string
+	consumes   []string
+	produces   string
+	priority   int
+
+	// Value of the Cache-Control header set by CacheFor
+	cacheControl string
+
+	// Name of the route for observability, see Label
+	label string
+
+	// Whether no redirects lead to the route, see Router.Exact.
+	// Only used for the first route of a group.
+	exact bool
+
+	// Set to 1 while the route is disabled, see Router.Disable.
+	// Only used for the first route of a group. Accessed atomically.
+	disabled int32
+
+	// All routes registered for the same method and path, in order of
+	// registration. Only set for the first of them.
+	group []*Route
+}
+
+type queryParam struct {
+	key   string
+	value string
+}
+
+// Query restricts the route to requests with the given query parameter value,
+// e.g. for legacy APIs dispatching on ?action=.
+// Multiple routes may be registered for the same method and path, as long as
+// all but the last one are restricted by query values, required query
+// parameters or validated params, see RequireQuery and Validate. The route is
+// then chosen among them by the request, in order of registration. The last
+// one may be unrestricted and serves as the default. If no route matches, the
+// request is handled as if no route was registered for the path, see Validate.
+func (rt *Route) Query(key, value string) *Route {
+	rt.query = append(rt.query, queryParam{key, value})
+	rt.router.restrict()
+	return rt
+}
+
+// RequireQuery restricts the route to requests with the given query parameter,
+// regardless of its value, e.g. an OAuth callback which must receive ?code=.
+// An empty value, like in ?code= or ?code, counts as present.
+// Like with Query, requests without the parameter fall through to the next
+// route registered for the same method and path, and if none matches, they are
+// handled as not found.
+func (rt *Route) RequireQuery(key string) *Route {
+	rt.queryKeys = append(rt.queryKeys, key)
+	rt.router.restrict()
+	return rt
+}
+
+type paramValidator struct {
+	name  string
+	valid func(string) bool
+}
+
+// Validate restricts the route to requests for which the value of the named
+// path parameter is accepted by the given function, e.g. to only match
+// positive integer IDs:
+//
+//	router.GET("/order/:id", handle).Validate("id", func(s string) bool {
+//		n, err := strconv.Atoi(s)
+//		return err == nil && n > 0
+//	})
+//
+// If the value is rejected, the route does not match. Like with Query, the
+// next route registered for the same method and path is tried. If none
+// matches, the lookup continues as if no route was registered for the path,
+// e.g. with a route registered with Any, before the request is handled as not
+// found. Neither the middleware nor OnMatch see the request then.
+// The function may be called more than once per request.
+func (rt *Route) Validate(name string, valid func(string) bool) *Route {
+	if valid == nil {
+		panic("validation function must not be nil")
+	}
+	if !hasParam(rt.path, name) {
+		panic("no parameter '" + name + "' in path '" + rt.path + "'")
+	}
+	rt.validators = append(rt.validators, paramValidator{name, valid})
+	rt.router.restrict()
+	return rt
+}
+
+// Reports whether the path has a parameter with the given name.
+func hasParam(path, name string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') && segment[1:] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Push sets resources which are pushed to the client using HTTP/2 server push
+// before the handle is invoked, e.g. stylesheets of a page.
+// If the http.ResponseWriter does not implement http.Pusher, e.g. for HTTP/1.1
+// connections, or pushing fails, the resources are not pushed. Server push
+// requires Go 1.8 or later.
+func (rt *Route) Push(targets ...string) *Route {
+	rt.push = append(rt.push, targets...)
+	return rt
+}
+
+// Priority sets the priority of the route, which decides between routes
+// matching the same request through different mechanisms: a route registered
+// for the request method, a route registered with Any and a prefix registered
+// with PrefixMatch, which has priority 0.
+// The match with the highest priority wins. On a tie, the default order
+// applies: routes for the request method first, then Any routes, then
+// prefixes. The default priority is 0.
+// Among the routes of one method the tree decides, where static segments win
+// over parameters and parameters over catch-alls.
+// For multiple routes registered for the same method and path, see Query, the
+// priority of the first one applies.
+func (rt *Route) Priority(priority int) *Route {
+	rt.priority = priority
+	if priority != 0 {
+		rt.router.prioritized = true
+		rt.router.cache.reset()
+	}
+	return rt
+}
+
+// Consumes restricts the content types of request bodies the route accepts.
+// Requests with another Content-Type are rejected with status code 415
+// before the handle is invoked. Types may contain wildcards, e.g.
+// "application/*". Parameters like charset are ignored.
+// The check is skipped for GET, HEAD, OPTIONS and TRACE requests, which have
+// no body.
+func (rt *Route) Consumes(types ...string) *Route {
+	for _, t := range types {
+		rt.consumes = append(rt.consumes, strings.ToLower(t))
+	}
+	return rt
+}
+
+// Produces sets the default Content-Type header of responses of the route,
+// e.g. "application/json". The header is set before the handle is invoked, so
+// the handle can still override it.
+func (rt *Route) Produces(contentType string) *Route {
+	rt.produces = contentType
+	return rt
+}
+
+// Label sets a stable name for the route, which Router.OnMatch receives
+// instead of the path of the route, e.g. to keep the names of metrics stable
+// when the path changes or to group several routes under one name.
+//
+//	router.GET("/user/:id", handle).Label("user_detail")
+func (rt *Route) Label(label string) *Route {
+	if label == "" {
+		panic("route label must not be empty")
+	}
+	rt.label = label
+	return rt
+}
+
+// CacheFor lets clients cache successful responses of the route for the given
+// duration, rounded down to whole seconds: the header Cache-Control: max-age=N
+// is set on responses with a 2xx status code to GET and HEAD requests, unless
+// the handle sets a Cache-Control header itself.
+// Since the header is set when the handle writes the response, it is also
+// sent with the 304 responses of the ETag middleware, which revalidate the
+// cached response.
+//
+//	router.GET("/data", handle).CacheFor(5 * time.Minute)
+func (rt *Route) CacheFor(d time.Duration) *Route {
+	if d < 0 {
+		panic("cache duration must not be negative")
+	}
+	rt.cacheControl = "max-age=" + strconv.FormatInt(int64(d/time.Second), 10)
+	return rt
+}
+
+// cacheWriter sets the Cache-Control header of successful responses.
+type cacheWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	wroteHeader  bool
+}
+
+func (cw *cacheWriter) setHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	if code >= 200 && code < 300 && cw.Header().Get("Cache-Control") == "" {
+		cw.Header().Set("Cache-Control", cw.cacheControl)
+	}
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	cw.setHeader(code)
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	cw.setHeader(http.StatusOK)
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher.
+func (cw *cacheWriter) Flush() {
+	cw.setHeader(http.StatusOK)
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Reports whether the content type of the request body is accepted.
+func (rt *Route) acceptsBody(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	ct, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range rt.consumes {
+		if matchMediaType(t, ct) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the route only matches requests with certain properties
+// besides method and path.
+func (rt *Route) discriminated() bool {
+	for _, route := range rt.group {
+		if !route.restricted() {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the route itself only matches requests with certain
+// properties besides method and path.
+func (rt *Route) restricted() bool {
+	return len(rt.query) > 0 || len(rt.queryKeys) > 0 || len(rt.validators) > 0
+}
+
+// Reports whether the query values and params of the request match the route.
+func (rt *Route) match(query url.Values, ps Params) bool {
+	for _, qp := range rt.query {
+		if query.Get(qp.key) != qp.value {
+			return false
+		}
+	}
+	for _, key := range rt.queryKeys {
+		if _, ok := query[key]; !ok {
+			return false
+		}
+	}
+	for _, v := range rt.validators {
+		if !v.valid(ps.ByName(v.name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// serve is the handle registered in the tree. It chooses the route among the
+// group of routes with the same method and path and invokes its handle.
+func (rt *Route) serve(w http.ResponseWriter, req *http.Request, ps Params) {
+	if atomic.LoadInt32(&rt.disabled) != 0 {
+		rt.router.serveDisabled(w)
+		return
+	}
+
+	if len(rt.group) == 1 && !rt.restricted() {
+		rt.invoke(w, req, ps)
+		return
+	}
+
+	if route := rt.choose(req, ps); route != nil {
+		route.invoke(w, req, ps)
+		return
+	}
+	rt.router.handleNotFound(w, req)
+}
+
+// choose returns the first route of the group which matches the request, or
+// nil if none does.
+func (rt *Route) choose(req *http.Request, ps Params) *Route {
+	query := req.URL.Query()
+	for _, route := range rt.group {
+		if route.match(query, ps) {
+			return route
+		}
+	}
+	return nil
+}
+
+// invoke applies the options of the route and invokes its handle.
+func (rt *Route) invoke(w http.ResponseWriter, req *http.Request, ps Params) {
+	if onMatch := rt.router.OnMatch; onMatch != nil {
+		if rt.label != "" {
+			onMatch(req, rt.label)
+		} else {
+			onMatch(req, rt.path)
+		}
+	}
+
+	if len(rt.consumes) > 0 && !rt.acceptsBody(req) {
+		http.Error(w,
+			http.StatusText(http.StatusUnsupportedMediaType),
+			http.StatusUnsupportedMediaType,
+		)
+		return
+	}
+
+	if rt.produces != "" {
+		w.Header().Set("Content-Type", rt.produces)
+	}
+
+	if len(rt.push) > 0 {
+		push(w, rt.push)
+	}
+
+	if rt.cacheControl != "" && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		w = &cacheWriter{ResponseWriter: w, cacheControl: rt.cacheControl}
+	}
+
+	rt.handle(w, req, ps)
+}
+
+// RouteInfo describes a registered route, see Router.Routes.
+type RouteInfo struct {
+	// The method of the route, or "" for routes registered with Any
+	Method string
+
+	// The path of the route as registered, with parameters in the native
+	// syntax, e.g. /users/:id, and blank segments as _, e.g. /api/_/users
+	Path string
+}
+
+// Routes returns all registered routes, sorted by method and path.
+// Routes registered for the same method and path, see Query, are only
+// listed once.
+func (r *Router) Routes() []RouteInfo {
+	return r.RoutesUnder("")
+}
+
+// RoutesUnder returns the registered routes whose path starts with the prefix,
+// e.g. "/api", for all methods, sorted by method and path.
+// Only the part of the trees below the prefix is walked.
+func (r *Router) RoutesUnder(prefix string) []RouteInfo {
+	methods := make([]string, 0, len(r.trees))
+	for method := range r.trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var routes []RouteInfo
+	for _, method := range methods {
+		start := len(routes)
+		info := RouteInfo{Method: method}
+		if method == methodAny {
+			info.Method = ""
+		}
+		r.trees[method].walkPrefix(prefix, func(n *node) {
+			info.Path = untranslateBlank(n.fullPath)
+			routes = append(routes, info)
+		})
+		// Sort the paths of the method by insertion sort
+		for i := start + 1; i < len(routes); i++ {
+			for j := i; j > start && routes[j].Path < routes[j-1].Path; j-- {
+				routes[j], routes[j-1] = routes[j-1], routes[j]
+			}
+		}
+	}
+	return routes
+}
@@ -0,0 +1,486 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRouteQuery(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.GET("/rpc", handle("delete")).Query("action", "delete")
+	router.GET("/rpc", handle("create")).Query("action", "create")
+	router.GET("/rpc", handle("default"))
+	router.GET("/strict", handle("strict")).Query("action", "delete")
+
+	tests := []struct {
+		route  string
+		code   int
+		routed string
+	}{
+		{"/rpc?action=delete", http.StatusOK, "delete"},
+		{"/rpc?action=create", http.StatusOK, "create"},
+		{"/rpc?action=other", http.StatusOK, "default"},
+		{"/rpc", http.StatusOK, "default"},
+		{"/strict?action=delete", http.StatusOK, "strict"},
+		{"/strict?action=create", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: want %d %q, got %d %q", test.route, test.code, test.routed, w.Code, routed)
+		}
+	}
+
+	// a route without query restriction can not be followed by another one
+	recv := catchPanic(func() {
+		router.GET("/rpc", handle("again"))
+	})
+	if recv == nil {
+		t.Error("registering a second default route did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.GET("/plain", handle("plain"))
+		router.GET("/plain", handle("plain"))
+	})
+	if recv == nil {
+		t.Error("registering a duplicate route did not panic")
+	}
+}
+
+func TestRouteRequireQuery(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.GET("/callback", handle("oauth")).RequireQuery("code")
+	router.GET("/callback", handle("error")).RequireQuery("error").Query("state", "x")
+	router.GET("/callback", handle("default"))
+	router.GET("/strict", handle("strict")).RequireQuery("code")
+
+	tests := []struct {
+		route  string
+		code   int
+		routed string
+	}{
+		{"/callback?code=abc", http.StatusOK, "oauth"},
+		{"/callback?code=", http.StatusOK, "oauth"},
+		{"/callback?code", http.StatusOK, "oauth"},
+		{"/callback?state=x&code=abc", http.StatusOK, "oauth"},
+		{"/callback?error=denied&state=x", http.StatusOK, "error"},
+		{"/callback?error=denied", http.StatusOK, "default"},
+		{"/callback?codes=abc", http.StatusOK, "default"},
+		{"/callback", http.StatusOK, "default"},
+		{"/strict?code=abc", http.StatusOK, "strict"},
+		{"/strict", http.StatusNotFound, ""},
+		{"/strict?other=1", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: want %d %q, got %d %q", test.route, test.code, test.routed, w.Code, routed)
+		}
+	}
+}
+
+func TestRouteValidate(t *testing.T) {
+	var routed, id string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			id = ps.ByName("id")
+		}
+	}
+	positive := func(s string) bool {
+		n, err := strconv.Atoi(s)
+		return err == nil && n > 0
+	}
+
+	router := New()
+	router.GET("/order/:id", handle("order")).Validate("id", positive)
+	router.GET("/user/:id", handle("numeric")).Validate("id", positive)
+	router.GET("/user/:id", handle("name"))
+
+	tests := []struct {
+		route  string
+		code   int
+		routed string
+		id     string
+	}{
+		{"/order/42", http.StatusOK, "order", "42"},
+		{"/order/-1", http.StatusNotFound, "", ""},
+		{"/order/abc", http.StatusNotFound, "", ""},
+		{"/user/7", http.StatusOK, "numeric", "7"},
+		{"/user/gopher", http.StatusOK, "name", "gopher"},
+	}
+	for _, test := range tests {
+		routed, id = "", ""
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed || id != test.id {
+			t.Errorf("%s: want %d %q %q, got %d %q %q",
+				test.route, test.code, test.routed, test.id, w.Code, routed, id)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.GET("/item/:id", handle("item")).Validate("name", positive)
+	})
+	if recv == nil {
+		t.Error("validating an unknown parameter did not panic")
+	}
+}
+
+func TestRouteValidateContinues(t *testing.T) {
+	var routed string
+	var gated, matched []string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + " " + ps[0].Value
+		}
+	}
+	positive := func(s string) bool {
+		n, err := strconv.Atoi(s)
+		return err == nil && n > 0
+	}
+
+	router := New()
+	router.Gate = func(_ http.ResponseWriter, _ *http.Request, pattern string) bool {
+		gated = append(gated, pattern)
+		return true
+	}
+	router.OnMatch = func(_ *http.Request, route string) {
+		matched = append(matched, route)
+	}
+	router.GET("/order/:id", handle("order")).Validate("id", positive)
+	router.Any("/order/:slug", handle("any"))
+	router.GET("/item/:id", handle("item")).Validate("id", positive)
+
+	tests := []struct {
+		route   string
+		code    int
+		routed  string
+		matched []string
+	}{
+		{"/order/42", http.StatusOK, "order 42", []string{"/order/:id"}},
+		{"/order/latest", http.StatusOK, "any latest", []string{"/order/:slug"}},
+		{"/item/-1", http.StatusNotFound, "", nil},
+	}
+	for _, test := range tests {
+		routed, gated, matched = "", nil, nil
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: want %d %q, got %d %q", test.route, test.code, test.routed, w.Code, routed)
+		}
+		if !reflect.DeepEqual(gated, test.matched) || !reflect.DeepEqual(matched, test.matched) {
+			t.Errorf("%s: want matches %v, got Gate %v and OnMatch %v", test.route, test.matched, gated, matched)
+		}
+
+		handle, _, _ := router.LookupRequest(httptest.NewRequest(http.MethodGet, test.route, nil))
+		if (handle != nil) != (test.code == http.StatusOK) {
+			t.Errorf("%s: LookupRequest disagrees with ServeHTTP", test.route)
+		}
+	}
+}
+
+func TestRouteConsumes(t *testing.T) {
+	var routed bool
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}
+
+	router := New()
+	router.POST("/users", handle).Consumes("application/json", "application/x-www-form-urlencoded")
+	router.PUT("/blobs", handle).Consumes("image/*")
+	router.GET("/users", handle).Consumes("application/json")
+
+	tests := []struct {
+		method      string
+		route       string
+		contentType string
+		code        int
+	}{
+		{http.MethodPost, "/users", "application/json", http.StatusOK},
+		{http.MethodPost, "/users", "Application/JSON; charset=utf-8", http.StatusOK},
+		{http.MethodPost, "/users", "application/x-www-form-urlencoded", http.StatusOK},
+		{http.MethodPost, "/users", "text/plain", http.StatusUnsupportedMediaType},
+		{http.MethodPost, "/users", "", http.StatusUnsupportedMediaType},
+		{http.MethodPut, "/blobs", "image/png", http.StatusOK},
+		{http.MethodPut, "/blobs", "text/plain", http.StatusUnsupportedMediaType},
+		{http.MethodGet, "/users", "text/plain", http.StatusOK},
+	}
+	for _, test := range tests {
+		routed = false
+		r := httptest.NewRequest(test.method, test.route, nil)
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s with %q: want status %d, got %d",
+				test.method, test.route, test.contentType, test.code, w.Code)
+		}
+		if routed != (test.code == http.StatusOK) {
+			t.Errorf("%s %s with %q: handle called: %t", test.method, test.route, test.contentType, routed)
+		}
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.GET("/*path", handle("catch-all"))
+	router.Any("/api/users", handle("users")).Priority(10)
+	router.Any("/api/groups", handle("groups"))
+	router.PrefixMatch("/static-", handle("static"))
+	router.POST("/static-:v/*path", handle("low")).Priority(-1)
+
+	tests := []struct {
+		method string
+		route  string
+		routed string
+	}{
+		// the specific route with a high priority beats the catch-all
+		{http.MethodGet, "/api/users", "users"},
+		{http.MethodPost, "/api/users", "users"},
+		// default order on a tie
+		{http.MethodGet, "/api/groups", "catch-all"},
+		{http.MethodPost, "/api/groups", "groups"},
+		{http.MethodGet, "/other", "catch-all"},
+		// the prefix beats the route with a negative priority
+		{http.MethodPost, "/static-abc/app.js", "static"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r := httptest.NewRequest(test.method, test.route, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != test.routed {
+			t.Errorf("%s %s: want %q, got %q", test.method, test.route, test.routed, routed)
+		}
+	}
+}
+
+func TestRouteProduces(t *testing.T) {
+	router := New()
+	router.GET("/api/x", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte(`{}`))
+	}).Produces("application/json")
+	router.GET("/api/csv", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("a,b"))
+	}).Produces("application/json")
+
+	tests := []struct {
+		route       string
+		contentType string
+	}{
+		{"/api/x", "application/json"},
+		{"/api/csv", "text/csv"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: want Content-Type %q, got %q", test.route, test.contentType, got)
+		}
+	}
+}
+
+func TestRouteCacheFor(t *testing.T) {
+	status := http.StatusOK
+	override := ""
+	handle := func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		if override != "" {
+			w.Header().Set("Cache-Control", override)
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+		}
+		w.Write([]byte("data"))
+	}
+
+	router := New()
+	router.GET("/data", handle).CacheFor(5 * time.Minute)
+	router.HEAD("/data", handle).CacheFor(5 * time.Minute)
+	router.POST("/data", handle).CacheFor(5 * time.Minute)
+
+	tests := []struct {
+		method   string
+		status   int
+		override string
+		want     string
+	}{
+		{http.MethodGet, http.StatusOK, "", "max-age=300"},
+		{http.MethodGet, http.StatusNoContent, "", "max-age=300"},
+		{http.MethodGet, http.StatusInternalServerError, "", ""},
+		{http.MethodGet, http.StatusNotFound, "", ""},
+		{http.MethodGet, http.StatusOK, "no-store", "no-store"},
+		{http.MethodHead, http.StatusOK, "", "max-age=300"},
+		{http.MethodPost, http.StatusOK, "", ""},
+	}
+	for _, test := range tests {
+		status, override = test.status, test.override
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, "/data", nil))
+		if got := w.Header().Get("Cache-Control"); got != test.want {
+			t.Errorf("%s with status %d: want Cache-Control %q, got %q", test.method, test.status, test.want, got)
+		}
+	}
+
+	// with the ETag middleware, revalidations keep the header
+	status, override = http.StatusOK, ""
+	router.Use(ETag())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") != "max-age=300" {
+		t.Fatalf("want ETag and Cache-Control, got %v", w.Header())
+	}
+	r := httptest.NewRequest(http.MethodGet, "/data", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Header().Get("Cache-Control") != "max-age=300" {
+		t.Errorf("revalidation: want 304 with Cache-Control, got %d %v", w.Code, w.Header())
+	}
+
+	if recv := catchPanic(func() { router.GET("/neg", handle).CacheFor(-time.Second) }); recv == nil {
+		t.Error("negative duration did not panic")
+	}
+}
+
+func TestRouteLabel(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	// a metrics observer counting requests per route
+	counts := make(map[string]int)
+	router := New()
+	router.OnMatch = func(r *http.Request, route string) {
+		counts[r.Method+" "+route]++
+	}
+	router.GET("/user/:id", handle).Label("user_detail")
+	router.GET("/user/:id/posts", handle)
+	router.GET("/rpc", handle).Query("action", "delete").Label("rpc_delete")
+	router.GET("/rpc", handle)
+
+	for _, path := range []string{"/user/1", "/user/2", "/user/3/posts", "/rpc?action=delete", "/rpc", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := map[string]int{
+		"GET user_detail":     2,
+		"GET /user/:id/posts": 1,
+		"GET rpc_delete":      1,
+		"GET /rpc":            1,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("wrong requests per route:\nwant %v\n got %v", want, counts)
+	}
+
+	if recv := catchPanic(func() { router.GET("/x", handle).Label("") }); recv == nil {
+		t.Error("no panic for empty label")
+	}
+}
+
+func TestRouterRoutesUnder(t *testing.T) {
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", h)
+	router.GET("/apis", h)
+	router.GET("/api/users/:id", h)
+	router.GET("/api/users", h)
+	router.POST("/api/users", h)
+	router.GET("/api/files/*filepath", h)
+	router.GET("/about", h)
+	router.DELETE("/admin/:id", h)
+	router.Any("/api/health", h)
+
+	want := []RouteInfo{
+		{"", "/api/health"},
+		{"GET", "/api/files/*filepath"},
+		{"GET", "/api/users"},
+		{"GET", "/api/users/:id"},
+		{"POST", "/api/users"},
+	}
+	if got := router.RoutesUnder("/api/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes under /api/:\nwant %v\n got %v", want, got)
+	}
+
+	// The prefix may end within a node of the tree
+	want = []RouteInfo{
+		{"GET", "/api/users"},
+		{"GET", "/api/users/:id"},
+		{"POST", "/api/users"},
+	}
+	if got := router.RoutesUnder("/api/us"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes under /api/us:\nwant %v\n got %v", want, got)
+	}
+
+	if got := router.RoutesUnder("/apx"); got != nil {
+		t.Errorf("expected no routes under /apx, got %v", got)
+	}
+
+	// All but the root route
+	if got := router.RoutesUnder("/a"); len(got) != 8 {
+		t.Errorf("expected 8 routes under /a, got %d: %v", len(got), got)
+	}
+
+	if got := router.Routes(); len(got) != 9 {
+		t.Errorf("expected 9 routes, got %d: %v", len(got), got)
+	}
+}
+
+func TestRouterRoutesBlank(t *testing.T) {
+	h := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/a/_/c", h)
+	router.GET("/_/b/_", h)
+	router.GET("/x/_y", h)
+
+	// blank segments are listed as registered
+	want := []RouteInfo{
+		{"GET", "/_/b/_"},
+		{"GET", "/a/_/c"},
+		{"GET", "/x/_y"},
+	}
+	if got := router.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %v\n got %v", want, got)
+	}
+}
@@ -53,6 +53,52 @@
 //   /blog/go/                           no match
 //   /blog/go/request-routers/comments   no match
 //
+// A named parameter may also follow a static prefix within a segment, e.g. to
+// capture a file extension. It then matches the rest of the segment:
+//  Path: /data.:format
+//
+//  Requests:
+//   /data.json                          match: format="json"
+//   /data.xml                           match: format="xml"
+//   /data.                              no match
+//
+// The length of a named parameter can be limited by appending {max=N}, where N
+// is the maximum length of the raw (escaped) path segment in bytes. Longer
+// segments don't match. The limit applies to all routes sharing the parameter:
+//  Path: /orders/:id{max=36}
+//
+//  Requests:
+//   /orders/123e4567-e89b-12d3-a456-426614174000    match: id="123e4567-..."
+//   /orders/123e4567-e89b-12d3-a456-4266141740001   no match
+//
+// Likewise, appending [N] requires the raw path segment to consist of exactly N
+// comma separated values, which can be split with Params.Split. The arity
+// applies to all routes sharing the parameter, too:
+//  Path: /point/:coords[2]
+//
+//  Requests:
+//   /point/12,34                        match: coords="12,34"
+//   /point/12                           no match
+//   /point/12,34,56                     no match
+//
+// Trailing named parameters may declare a default value with =value. The
+// route then also matches the path without them, and the default values are
+// passed instead:
+//  Path: /list/:page=1
+//
+//  Requests:
+//   /list/3                             match: page="3"
+//   /list                               match: page="1"
+//
+// A segment consisting of a single '_' matches any one segment, like a named
+// parameter, but its value is not captured. It can be used to ignore segments:
+//  Path: /api/_/users/:id
+//
+//  Requests:
+//   /api/v1/users/42                    match: id="42"
+//   /api/v2/users/42                    match: id="42"
+//   /api/users/42                       no match
+//
 // Catch-all parameters match anything until the path end, including the
 // directory index (the '/' before the catch-all). Since they match anything
 // until the end, catch-all parameters must always be the final path element.
@@ -77,10 +123,18 @@
 package httprouter
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Handle is a function that can be registered to a route to handle HTTP
@@ -88,6 +142,10 @@ import (
 // wildcards (path variables).
 type Handle func(http.ResponseWriter, *http.Request, Params)
 
+// HandleE is like Handle, but returns an error, which is passed on to the
+// Router's ErrorResponder. See Router.HandleErr.
+type HandleE func(http.ResponseWriter, *http.Request, Params) error
+
 // Param is a single URL parameter, consisting of a key and a value.
 type Param struct {
 	Key   string
@@ -110,6 +168,29 @@ func (ps Params) ByName(name string) string {
 	return ""
 }
 
+// Get returns the value of the first Param which key matches the given name
+// and whether such a Param was found. In contrast to ByName, it distinguishes
+// between a missing parameter and a parameter with an empty value.
+func (ps Params) Get(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Map returns the Params as a map of keys to values, e.g. for passing them
+// to a template. If a key occurs multiple times, the first value wins, like
+// with ByName.
+func (ps Params) Map() map[string]string {
+	m := make(map[string]string, len(ps))
+	for i := len(ps) - 1; i >= 0; i-- {
+		m[ps[i].Key] = ps[i].Value
+	}
+	return m
+}
+
 type paramsKey struct{}
 
 // ParamsKey is the request context key under which URL params are stored.
@@ -122,6 +203,41 @@ func ParamsFromContext(ctx context.Context) Params {
 	return p
 }
 
+// ContextWithParams returns a copy of ctx with the params stored under
+// ParamsKey, like the router does for handlers registered with Handler, e.g.
+// to invoke such handlers directly in tests.
+func ContextWithParams(ctx context.Context, ps Params) context.Context {
+	return context.WithValue(ctx, ParamsKey, ps)
+}
+
+// NewParams returns Params with the given keys and values, which alternate,
+// e.g. for invoking handles directly in tests:
+//
+//	handle(w, req, httprouter.NewParams("user", "gopher", "id", "42"))
+//
+// NewParams panics if an odd number of strings is given.
+func NewParams(pairs ...string) Params {
+	if len(pairs)%2 != 0 {
+		panic("odd number of strings, keys and values must alternate")
+	}
+	ps := make(Params, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		ps = append(ps, Param{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return ps
+}
+
+type attemptedPathKey struct{}
+
+// AttemptedPathFromContext returns the cleaned request path, see CleanPath,
+// for which the router found no route, e.g. for logging in the NotFound
+// handler. It is only available in the context of requests passed to the
+// NotFound handlers and the DefaultHandler, otherwise "" is returned.
+func AttemptedPathFromContext(ctx context.Context) string {
+	path, _ := ctx.Value(attemptedPathKey{}).(string)
+	return path
+}
+
 // MatchedRoutePathParam is the Param name under which the path of the matched
 // route is stored, if Router.SaveMatchedRoutePath is set.
 var MatchedRoutePathParam = "$matchedRoutePath"
@@ -133,18 +249,94 @@ func (ps Params) MatchedRoutePath() string {
 	return ps.ByName(MatchedRoutePathParam)
 }
 
+// IndexOf returns the index of the path segment at which the param with the
+// given name was captured, counting from 0 for the first segment after the
+// leading '/'. For example for the route /a/:b/c/:d the params b and d have the
+// indices 1 and 3.
+// The index is derived from the matched route path, hence
+// Router.SaveMatchedRoutePath must have been enabled. If the route path is
+// not available or has no param with the given name, -1 is returned.
+func (ps Params) IndexOf(name string) int {
+	path := ps.MatchedRoutePath()
+	for i, index := 0, 0; i < len(path); index++ {
+		// skip the '/' in front of the segment
+		i++
+		end := strings.IndexByte(path[i:], '/')
+		if end < 0 {
+			end = len(path)
+		} else {
+			end += i
+		}
+		if seg := path[i:end]; len(seg) > 1 && (seg[0] == ':' || seg[0] == '*') && seg[1:] == name {
+			return index
+		}
+		i = end
+	}
+	return -1
+}
+
+// EmptySegmentPolicy defines how request paths with empty segments, like /a//b,
+// are handled, see Router.EmptySegmentPolicy. A trailing slash does not count
+// as an empty segment.
+type EmptySegmentPolicy uint8
+
+const (
+	// The path is routed as it is: empty segments are matched by catch-all
+	// parameters, but not by named parameters. If no route matches, clients
+	// are redirected to the cleaned path if RedirectFixedPath is enabled.
+	EmptySegmentDefault EmptySegmentPolicy = iota
+	// Requests are answered with status code 400 before the tree is walked.
+	EmptySegmentReject
+	// Consecutive slashes are collapsed into one, e.g. /a//b is routed like
+	// /a/b, and the request URL is changed accordingly. Clients are not
+	// redirected.
+	EmptySegmentCollapse
+	// Named parameters also match empty segments, e.g. /a/:x/b matches /a//b
+	// with x="".
+	EmptySegmentMatch
+)
+
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Router struct {
-	trees map[string]*node
+	trees  map[string]*node
+	routes map[string]map[string]*Route
 
 	paramsPool sync.Pool
 	maxParams  uint16
 
+	cache resolveCache
+
+	// Holds the *middlewareStack
+	mws atomic.Value
+
+	prefixes []prefixRoute
+
+	// Route registered for server-wide OPTIONS * requests
+	serverOPTIONS *Route
+
+	// Whether a route has a priority set
+	prioritized bool
+
+	// Whether a route was registered with Exact
+	hasExact bool
+
+	// Whether a route was restricted with Query, RequireQuery or Validate
+	restricted bool
+
+	// Holds the *Router serving requests after Swap
+	live atomic.Value
+
+	// Number of requests currently served, accessed atomically
+	inFlight int32
+
 	// If enabled, adds the matched route path onto the http.Request context
 	// before invoking the handler.
-	// The matched route path is only added to handlers of routes that were
-	// registered when this option was enabled.
+	// The matched route path is added before the middleware registered with
+	// Use and UseFor is invoked, so middleware can read it as well, e.g. to
+	// authorize requests per route.
+	// Handles returned by Lookup only carry the matched route path for routes
+	// that were registered when this option was enabled.
 	SaveMatchedRoutePath bool
 
 	// Enables automatic redirection if the current route can't be matched but a
@@ -154,6 +346,23 @@ type Router struct {
 	// and 308 for all other request methods.
 	RedirectTrailingSlash bool
 
+	// If enabled, a request which can't be matched but for which a handler for
+	// the path with (without) the trailing slash exists, is served directly by
+	// that handler instead of being redirected. The request path is rewritten
+	// accordingly.
+	// This is useful for e.g. POST requests, which should not be redirected.
+	// RewriteTrailingSlash takes precedence over RedirectTrailingSlash.
+	RewriteTrailingSlash bool
+
+	// If enabled, a trailing slash is optional when matching request paths:
+	// a request which can't be matched but for which a handler for the path
+	// with (without) the trailing slash exists, is served by that handler.
+	// For example a route registered for /users/:id serves both /users/7 and
+	// /users/7/ directly, without a redirect.
+	// Unlike RewriteTrailingSlash, the request path is left untouched and the
+	// alternative path is tried before routes registered with Any.
+	TolerateTrailingSlash bool
+
 	// If enabled, the router tries to fix the current request path, if no
 	// handle is registered for it.
 	// First superfluous path elements like ../ or // are removed.
@@ -165,6 +374,97 @@ type Router struct {
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// An optional function which is called with the request path and the
+	// corrected path whenever RedirectFixedPath redirects a request, e.g. to
+	// log case corrections. It is called before the redirect is sent.
+	OnFixedPath func(from, to string)
+
+	// If enabled, the redirects made due to RedirectTrailingSlash and
+	// RedirectFixedPath are permanent, i.e. status code 301 is used for GET
+	// requests and 308 for all other request methods.
+	// Otherwise the temporary status codes 302 and 307 are used, which are not
+	// cached by clients. This is e.g. useful during development.
+	PermanentRedirects bool
+
+	// If enabled, paths of registered routes may use the brace syntax known from
+	// other routers for parameters: {name} for named parameters and {name...}
+	// for catch-all parameters. They are translated to :name and *name at
+	// registration, e.g. /files/{filepath...} is registered as /files/*filepath.
+	BraceSyntax bool
+
+	// An optional function which rewrites the request path before it is
+	// matched, e.g. to map legacy URLs onto current routes. It receives the
+	// escaped request path and the returned path is used for routing and
+	// assigned back to the request URL. Returning the path unchanged is a no-op.
+	RewritePath func(path string) string
+
+	// If enabled, '+' in path parameter values is decoded as a space, like
+	// some clients expect. By default it is left as it is, since RFC 3986
+	// treats '+' in paths literally. An encoded plus (%2B) is never decoded as
+	// a space.
+	DecodePlusAsSpace bool
+
+	// If enabled, requests with a path containing an invalid percent-encoded
+	// sequence, like %zz or a truncated %4, are answered with status code 400
+	// before the tree is walked. By default the path is routed as it is and
+	// path parameter values containing such sequences are empty.
+	StrictUnescape bool
+
+	// How request paths with empty segments, like /a//b, are handled, see
+	// EmptySegmentPolicy. By default they are routed as they are.
+	EmptySegmentPolicy EmptySegmentPolicy
+
+	// If enabled, the request method is converted to upper case before the
+	// route is looked up, so that misbehaving clients sending e.g. "get" are
+	// routed to GET handles. Handles see the converted method.
+	// By default methods are case-sensitive, as required by RFC 7231.
+	CaseInsensitiveMethods bool
+
+	// Maximum number of request paths for which the result of the route
+	// resolution is cached, which avoids repeated tree walks for a small, fixed
+	// set of paths, e.g. of an internal RPC system. When the cache is full, it
+	// is cleared. Param values are still extracted per request.
+	// The cache also holds the Allow header values computed for OPTIONS and
+	// 405 responses. It is cleared whenever a route is added.
+	// A value of 0 disables the cache.
+	ResolveCacheSize int
+
+	// Maximum number of '/'-delimited segments a request path may contain.
+	// Requests with deeper paths are answered with status code 414 before the
+	// tree is walked, which protects against pathological inputs.
+	// A value of 0 means unlimited.
+	MaxSegments int
+
+	// Maximum number of routes which can be registered, counted across all
+	// methods, e.g. to bound the memory used by routes registered by untrusted
+	// tenants. Registering further routes panics with ErrTooManyRoutes, which
+	// TryHandle and Register return instead.
+	// A value of 0 means unlimited.
+	MaxRoutes int
+
+	// Number of routes registered
+	routeCount int
+
+	// Whether further routes can be registered, see Freeze
+	frozen bool
+
+	// The duration clients are told to wait in the Retry-After header of
+	// responses to routes disabled with Disable. It is rounded up to whole
+	// seconds. A value of 0 omits the header.
+	DisabledRetryAfter time.Duration
+
+	// If enabled, requests whose context is already canceled, e.g. because the
+	// client disconnected, are dropped after the route was matched: neither the
+	// handle nor its middleware are invoked and nothing is written.
+	// This saves work on abandoned requests, e.g. in a proxy.
+	SkipCanceledRequests bool
+
+	// Maximum size in bytes of the body of requests to matched routes.
+	// It is enforced with the MaxBodyBytes middleware, which runs before any
+	// middleware added with Use and UseFor.
+	// A value of 0 means unlimited.
+	MaxBodyBytes int64
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -173,23 +473,62 @@ type Router struct {
 	// handler.
 	HandleMethodNotAllowed bool
 
+	// Controls whether a 405 response takes precedence over the redirects of
+	// RedirectTrailingSlash and RedirectFixedPath, if the request can not be
+	// routed. Only relevant if HandleMethodNotAllowed is enabled.
+	//
+	// By default, redirects win: a request is redirected if a route for the
+	// path with (without) the trailing slash or the fixed path exists for the
+	// request method. If such a route exists only for other methods, the
+	// request is redirected as well, e.g. GET /path/ is redirected to /path if
+	// only POST /path is registered, and the client then receives a 405
+	// response for /path.
+	//
+	// If enabled, the request is answered with 405 right away if other methods
+	// are allowed for the path, or for the path with (without) the trailing
+	// slash if no such route exists for the request method. In the example
+	// above GET /path/ is answered with 405 and Allow: OPTIONS, POST.
+	MethodNotAllowedBeforeRedirect bool
+
 	// If enabled, the router automatically replies to OPTIONS requests.
 	// Custom OPTIONS handlers take priority over automatic replies.
 	HandleOPTIONS bool
 
 	// An optional http.Handler that is called on automatic OPTIONS requests.
 	// The handler is only called if HandleOPTIONS is true and no OPTIONS
-	// handler for the specific path was set.
+	// handler for the specific path (or "*" for server-wide requests) was set.
 	// The "Allowed" header is set before calling the handler.
 	GlobalOPTIONS http.Handler
 
+	// Headers which are set on every response before the request is handled,
+	// e.g. security headers like X-Content-Type-Options. This includes the
+	// responses of the NotFound, MethodNotAllowed and PanicHandler handlers,
+	// as well as redirects. Handlers can override them.
+	// The keys must be in canonical form, see http.CanonicalHeaderKey.
+	DefaultHeaders http.Header
+
+	// An optional CORS configuration. If set, the CORS headers are added to
+	// responses of matched routes for allowed origins, and preflight requests
+	// are answered automatically with status code 204, with both the Allow
+	// header and the CORS headers set.
+	// The precedence for OPTIONS requests is: a custom OPTIONS handler for the
+	// path, then the automatic CORS preflight response, then GlobalOPTIONS.
+	// Automatic preflight responses require HandleOPTIONS to be enabled.
+	CORS *CORS
+
 	// Cached value of global (*) allowed methods
 	globalAllowed string
 
 	// Configurable http.Handler which is called when no matching route is
 	// found. If it is not set, http.NotFound is used.
+	// If the handler is itself a *Router, the params captured before the lookup
+	// failed are stored in the request context, from where the chained router
+	// inherits them.
 	NotFound http.Handler
 
+	// NotFound handlers for specific request methods, see SetNotFound
+	methodNotFound map[string]http.Handler
+
 	// Configurable http.Handler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
 	// If it is not set, http.Error with http.StatusMethodNotAllowed is used.
@@ -197,12 +536,72 @@ type Router struct {
 	// is called.
 	MethodNotAllowed http.Handler
 
+	// Configurable http.Handler which is called instead of the NotFound and
+	// MethodNotAllowed handlers for requests with a method for which no route
+	// is registered and which is not one of the methods defined in RFC 7231
+	// and RFC 5789, e.g. BREW. Routes registered with Any and prefixes still
+	// match such requests. The handler typically replies with status code
+	// 501 Not Implemented:
+	//     router.UnknownMethodHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	//         http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+	//     })
+	UnknownMethodHandler http.Handler
+
+	// Configurable http.Handler which is called for requests no route
+	// matches, e.g. to proxy them to an upstream server while serving local
+	// routes. It is called instead of the redirects, the automatic OPTIONS
+	// responses and the MethodNotAllowed and NotFound handlers. Routes
+	// registered with Any and prefixes still match first.
+	// The handler can read why no route matched with MatchStatusFromContext
+	// and the cleaned request path with AttemptedPathFromContext.
+	DefaultHandler http.Handler
+
+	// An optional function which is called after a route was matched, but before
+	// the middleware and the handle are invoked, e.g. for rate limiting by
+	// route. The pattern is the path of the matched route, e.g. /user/:name.
+	// If it returns false, the request is aborted. The router then doesn't
+	// write a response, the function is expected to do so.
+	Gate func(w http.ResponseWriter, r *http.Request, pattern string) bool
+
+	// An optional function which is called with the name of the route which
+	// handles the request, e.g. to count requests per route. The name is the
+	// label set with Route.Label, or otherwise the path of the route, e.g.
+	// /user/:name. It is called after the middleware and before the handle of
+	// the route, also for routes chosen by query values, see Route.Query.
+	OnMatch func(r *http.Request, route string)
+
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate a error page and return the http error code
 	// 500 (Internal Server Error).
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
 	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+
+	// Like PanicHandler, but additionally receives the pattern of the matched
+	// route, which makes panic logs more actionable.
+	// If set, it is used instead of PanicHandler.
+	PanicHandler2 func(http.ResponseWriter, *http.Request, PanicInfo)
+
+	// If enabled, a recovered panic is re-panicked with the same value after
+	// the PanicHandler (or PanicHandler2) returned, so that it propagates out
+	// of ServeHTTP, e.g. to an outer recoverer which also closes the
+	// connection. The handler is called only once per panic.
+	RepanicAfterHandler bool
+
+	// An optional function which is called when a route is registered which is
+	// ambiguous with an already registered route of the same method: routes
+	// which can not coexist, e.g. /users/:name after /users/:id, or
+	// /files/:name after /files/*filepath, and routes matching the same
+	// request, e.g. /users/new after /users/:id.
+	// The function is informational: afterwards the route is registered as
+	// without it, which panics for routes which can not coexist. The function
+	// may panic itself, e.g. to fail a build.
+	OnRouteConflict func(existing, new string)
+
+	// Function to handle errors returned from handles registered with
+	// HandleErr. It is not called for handles returning nil.
+	// If it is not set, http.Error with http.StatusInternalServerError is used.
+	ErrorResponder func(http.ResponseWriter, *http.Request, error)
 }
 
 // Make sure the Router conforms with the http.Handler interface
@@ -214,19 +613,33 @@ func New() *Router {
 	return &Router{
 		RedirectTrailingSlash:  true,
 		RedirectFixedPath:      true,
+		PermanentRedirects:     true,
 		HandleMethodNotAllowed: true,
 		HandleOPTIONS:          true,
 	}
 }
 
+// flags returns the flags for looking up request paths in the trees.
+func (r *Router) flags() (flags lookupFlags) {
+	if r.DecodePlusAsSpace {
+		flags |= plusAsSpace
+	}
+	if r.EmptySegmentPolicy == EmptySegmentMatch {
+		flags |= emptyParams
+	}
+	return flags
+}
+
 func (r *Router) getParams() *Params {
 	ps, _ := r.paramsPool.Get().(*Params)
 	*ps = (*ps)[0:0] // reset slice
 	return ps
 }
 
+// putParams returns the params to the pool. Params which were not allocated
+// with the capacity required by the registered routes are discarded.
 func (r *Router) putParams(ps *Params) {
-	if ps != nil {
+	if ps != nil && cap(*ps) >= int(r.maxParams) {
 		r.paramsPool.Put(ps)
 	}
 }
@@ -239,6 +652,9 @@ func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 			ps[0] = Param{Key: MatchedRoutePathParam, Value: path}
 			handle(w, req, ps)
 			r.putParams(psp)
+		} else if _, ok := ps.Get(MatchedRoutePathParam); ok {
+			// already added by serveHandle, before any inherited params
+			handle(w, req, ps)
 		} else {
 			ps = append(ps, Param{Key: MatchedRoutePathParam, Value: path})
 			handle(w, req, ps)
@@ -246,39 +662,93 @@ func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 	}
 }
 
+// SetNotFoundJSON sets the NotFound handler to a handler which replies with
+// the given JSON body and status code 404.
+//     router.SetNotFoundJSON(`{"error":"not found"}`)
+func (r *Router) SetNotFoundJSON(body string) {
+	r.NotFound = jsonHandler(http.StatusNotFound, body)
+}
+
+// SetNotFound sets the handler which is called instead of NotFound when no
+// matching route is found for a request with the given method, e.g. to render
+// an HTML page for GET requests, while API requests get a JSON reply.
+// Requests with other methods still use NotFound. A nil handler removes the
+// handler for the method.
+//     router.SetNotFound(http.MethodGet, notFoundPage)
+func (r *Router) SetNotFound(method string, handler http.Handler) {
+	if method == "" {
+		panic("method must not be empty")
+	}
+	if handler == nil {
+		delete(r.methodNotFound, method)
+		return
+	}
+	if r.methodNotFound == nil {
+		r.methodNotFound = make(map[string]http.Handler)
+	}
+	r.methodNotFound[method] = handler
+}
+
+// SetMethodNotAllowedJSON sets the MethodNotAllowed handler to a handler which
+// replies with the given JSON body and status code 405.
+func (r *Router) SetMethodNotAllowedJSON(body string) {
+	r.MethodNotAllowed = jsonHandler(http.StatusMethodNotAllowed, body)
+}
+
+func jsonHandler(code int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	})
+}
+
 // GET is a shortcut for router.Handle(http.MethodGet, path, handle)
-func (r *Router) GET(path string, handle Handle) {
-	r.Handle(http.MethodGet, path, handle)
+func (r *Router) GET(path string, handle Handle) *Route {
+	return r.Handle(http.MethodGet, path, handle)
 }
 
 // HEAD is a shortcut for router.Handle(http.MethodHead, path, handle)
-func (r *Router) HEAD(path string, handle Handle) {
-	r.Handle(http.MethodHead, path, handle)
+func (r *Router) HEAD(path string, handle Handle) *Route {
+	return r.Handle(http.MethodHead, path, handle)
 }
 
 // OPTIONS is a shortcut for router.Handle(http.MethodOptions, path, handle)
-func (r *Router) OPTIONS(path string, handle Handle) {
-	r.Handle(http.MethodOptions, path, handle)
+func (r *Router) OPTIONS(path string, handle Handle) *Route {
+	return r.Handle(http.MethodOptions, path, handle)
 }
 
 // POST is a shortcut for router.Handle(http.MethodPost, path, handle)
-func (r *Router) POST(path string, handle Handle) {
-	r.Handle(http.MethodPost, path, handle)
+func (r *Router) POST(path string, handle Handle) *Route {
+	return r.Handle(http.MethodPost, path, handle)
 }
 
 // PUT is a shortcut for router.Handle(http.MethodPut, path, handle)
-func (r *Router) PUT(path string, handle Handle) {
-	r.Handle(http.MethodPut, path, handle)
+func (r *Router) PUT(path string, handle Handle) *Route {
+	return r.Handle(http.MethodPut, path, handle)
 }
 
 // PATCH is a shortcut for router.Handle(http.MethodPatch, path, handle)
-func (r *Router) PATCH(path string, handle Handle) {
-	r.Handle(http.MethodPatch, path, handle)
+func (r *Router) PATCH(path string, handle Handle) *Route {
+	return r.Handle(http.MethodPatch, path, handle)
 }
 
 // DELETE is a shortcut for router.Handle(http.MethodDelete, path, handle)
-func (r *Router) DELETE(path string, handle Handle) {
-	r.Handle(http.MethodDelete, path, handle)
+func (r *Router) DELETE(path string, handle Handle) *Route {
+	return r.Handle(http.MethodDelete, path, handle)
+}
+
+// methodAny is the key of the tree holding the routes registered with Any.
+// It is not a valid method token, hence no request can have it as its method.
+const methodAny = "<any>"
+
+// Any registers a new request handle with the given path for all request
+// methods, including non-standardized ones, e.g. for a proxy.
+// Routes registered for a specific method take precedence. Routes registered
+// with Any are only considered if no route for the request method matches the
+// path, but before any redirect or Method Not Allowed handling.
+func (r *Router) Any(path string, handle Handle) *Route {
+	return r.Handle(methodAny, path, handle)
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -289,37 +759,117 @@ func (r *Router) DELETE(path string, handle Handle) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (r *Router) Handle(method, path string, handle Handle) {
+//
+// The path "*" is only allowed with the OPTIONS method. The handle is then used
+// for server-wide OPTIONS * requests, instead of GlobalOPTIONS and the
+// automatic reply.
+//
+// The returned Route can be used to configure the route further.
+func (r *Router) Handle(method, path string, handle Handle) *Route {
 	varsCount := uint16(0)
 
+	if r.frozen {
+		panic(ErrFrozen)
+	}
 	if method == "" {
 		panic("method must not be empty")
 	}
-	if len(path) < 1 || path[0] != '/' {
+	if path == "*" {
+		if method != http.MethodOptions {
+			panic("path '*' is only allowed with method OPTIONS")
+		}
+	} else if len(path) < 1 || path[0] != '/' {
 		panic("path must begin with '/' in path '" + path + "'")
 	}
 	if handle == nil {
 		panic("handle must not be nil")
 	}
+	if r.MaxRoutes > 0 && r.routeCount >= r.MaxRoutes {
+		panic(ErrTooManyRoutes)
+	}
+
+	if strings.IndexByte(path, '=') >= 0 {
+		if base, defaults := parseParamDefaults(path); len(defaults) > 0 {
+			return r.handleDefaults(method, base, defaults, handle)
+		}
+	}
+
+	path, limits := parseParamLimits(path)
+
+	if r.BraceSyntax {
+		path = translateBraces(path)
+	}
+	path = translateBlank(path)
 
 	if r.SaveMatchedRoutePath {
 		varsCount++
 		handle = r.saveMatchedRoutePath(path, handle)
 	}
 
+	route := &Route{
+		router: r,
+		method: method,
+		path:   path,
+		handle: handle,
+	}
+
+	// The server-wide OPTIONS * route is not part of the tree
+	if path == "*" {
+		if r.serverOPTIONS != nil {
+			panic("a handle is already registered for path '*'")
+		}
+		route.group = []*Route{route}
+		r.serverOPTIONS = route
+		r.routeCount++
+		return route
+	}
+
+	// Another route for the same method and path may only be added, if all
+	// existing ones are distinguishable by other properties of the request
+	if first := r.routes[method][path]; first != nil {
+		if !first.discriminated() {
+			panic("a handle is already registered for path '" + path + "'")
+		}
+		applyParamLimits(r.trees[method], path, limits, true)
+		first.group = append(first.group, route)
+		r.routeCount++
+		return route
+	}
+	route.group = []*Route{route}
+
+	if r.OnRouteConflict != nil {
+		var conflicts []string
+		for existing := range r.routes[method] {
+			if routesConflict(existing, path) {
+				conflicts = append(conflicts, existing)
+			}
+		}
+		sort.Strings(conflicts)
+		for _, existing := range conflicts {
+			r.OnRouteConflict(existing, path)
+		}
+	}
+
 	if r.trees == nil {
 		r.trees = make(map[string]*node)
+		r.routes = make(map[string]map[string]*Route)
 	}
 
 	root := r.trees[method]
 	if root == nil {
 		root = new(node)
 		r.trees[method] = root
+		r.routes[method] = make(map[string]*Route)
 
 		r.globalAllowed = r.allowed("*", "")
 	}
 
-	root.addRoute(path, handle)
+	applyParamLimits(root, path, limits, false)
+	root.addRoute(path, route.serve)
+	applyParamLimits(root, path, limits, true)
+	r.cache.reset()
+	r.routes[method][path] = route
+	r.routeCount++
 
 	// Update maxParams
 	if paramsCount := countParams(path); paramsCount+varsCount > r.maxParams {
@@ -333,208 +883,1639 @@ func (r *Router) Handle(method, path string, handle Handle) {
 			return &ps
 		}
 	}
-}
 
-// Handler is an adapter which allows the usage of an http.Handler as a
-// request handle.
-// The Params are available in the request context under ParamsKey.
-func (r *Router) Handler(method, path string, handler http.Handler) {
-	r.Handle(method, path,
-		func(w http.ResponseWriter, req *http.Request, p Params) {
-			if len(p) > 0 {
-				ctx := req.Context()
-				ctx = context.WithValue(ctx, ParamsKey, p)
-				req = req.WithContext(ctx)
-			}
-			handler.ServeHTTP(w, req)
-		},
-	)
+	return route
 }
 
-// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
-// request handle.
-func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	r.Handler(method, path, handler)
+// HandleIf is like Handle, but only registers the route if cond is true, e.g.
+// for feature-flagged routes. Otherwise it does nothing and returns nil.
+//     router.HandleIf(cfg.BetaAPI, http.MethodGet, "/beta/users", listUsers)
+func (r *Router) HandleIf(cond bool, method, path string, handle Handle) *Route {
+	if !cond {
+		return nil
+	}
+	return r.Handle(method, path, handle)
 }
 
-// ServeFiles serves files from the given file system root.
-// The path must end with "/*filepath", files are then served from the local
-// path /defined/root/dir/*filepath.
-// For example if root is "/etc" and *filepath is "passwd", the local file
-// "/etc/passwd" would be served.
-// Internally a http.FileServer is used, therefore http.NotFound is used instead
-// of the Router's NotFound handler.
-// To use the operating system's file system implementation,
-// use http.Dir:
-//     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
-func (r *Router) ServeFiles(path string, root http.FileSystem) {
-	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
-		panic("path must end with /*filepath in path '" + path + "'")
+// Alias registers the path alias for all methods, including Any, for which a
+// route is registered for the path target, e.g. to serve /about-us like
+// /about. The route of target is resolved per request, so that changes of it,
+// e.g. by Disable and Enable, apply to the alias as well. The alias is a
+// regular route otherwise: redirects to it apply and middleware is applied
+// once, for the alias path.
+// The target must be given as registered, see HasRoute. Alias panics if no route is
+// registered for it, or if the params of the alias differ from those of the
+// target, e.g. /u/:uid for /users/:id, since the handle of the target reads
+// the params by their names.
+func (r *Router) Alias(alias, target string) {
+	target = r.routePattern(target)
+
+	var methods []string
+	for method, routes := range r.routes {
+		if routes[target] != nil {
+			methods = append(methods, method)
+		}
 	}
+	if len(methods) == 0 {
+		panic("no route is registered for path '" + target + "'")
+	}
+	sort.Strings(methods)
 
-	fileServer := http.FileServer(root)
+	aliasWildcards, targetWildcards := wildcards(r.routePattern(alias)), wildcards(target)
+	same := len(aliasWildcards) == len(targetWildcards)
+	for i := 0; same && i < len(aliasWildcards); i++ {
+		same = aliasWildcards[i] == targetWildcards[i]
+	}
+	if !same {
+		panic("params of alias '" + alias + "' differ from those of path '" + target + "'")
+	}
 
-	r.GET(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
-		req.URL.Path = ps.ByName("filepath")
-		fileServer.ServeHTTP(w, req)
-	})
+	for _, method := range methods {
+		method := method
+		r.Handle(method, alias, func(w http.ResponseWriter, req *http.Request, ps Params) {
+			r.routes[method][target].serve(w, req, ps)
+		})
+	}
 }
 
-func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
-	if rcv := recover(); rcv != nil {
-		r.PanicHandler(w, req, rcv)
+// Exact is like Handle, but the route only matches requests for exactly the
+// given path, e.g. for sensitive endpoints like /metrics. Requests for near
+// misses, like /metrics/ or /METRICS, are neither redirected to nor served by
+// the route, regardless of RedirectTrailingSlash, RedirectFixedPath,
+// RewriteTrailingSlash and TolerateTrailingSlash, but handled as not found.
+func (r *Router) Exact(method, path string, handle Handle) *Route {
+	route := r.Handle(method, path, handle)
+	if first := r.routes[method][route.path]; first != nil {
+		first.exact = true
+		r.hasExact = true
 	}
+	return route
 }
 
-// Lookup allows the manual lookup of a method + path combo.
-// This is e.g. useful to build a framework around this router.
-// If the path was found, it returns the handle function and the path parameter
-// values. Otherwise the third return value indicates whether a redirection to
-// the same path with an extra / without the trailing slash should be performed.
-func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
-	if root := r.trees[method]; root != nil {
-		handle, ps, tsr := root.getValue(path, r.getParams)
-		if handle == nil {
-			r.putParams(ps)
-			return nil, nil, tsr
-		}
-		if ps == nil {
-			return handle, nil, tsr
-		}
-		return handle, *ps, tsr
+// isExact reports whether the path matches a route for the method, which was
+// registered with Exact.
+func (r *Router) isExact(method, path string) bool {
+	root := r.trees[method]
+	if root == nil {
+		return false
 	}
-	return nil, nil, false
+	leaf, _, _ := root.lookup(path, nil, r.flags())
+	return leaf != nil && r.routes[method][leaf.fullPath].exact
 }
 
-func (r *Router) allowed(path, reqMethod string) (allow string) {
-	allowed := make([]string, 0, 9)
+// restrict marks the router as having restricted routes, see rejects.
+func (r *Router) restrict() {
+	r.restricted = true
+	r.cache.reset()
+}
 
-	if path == "*" { // server-wide
-		// empty method is used for internal calls to refresh the cache
-		if reqMethod == "" {
-			for method := range r.trees {
-				if method == http.MethodOptions {
-					continue
-				}
-				// Add request method to list of allowed methods
-				allowed = append(allowed, method)
-			}
-		} else {
-			return r.globalAllowed
-		}
-	} else { // specific path
-		for method := range r.trees {
-			// Skip the requested method - we already tried this one
-			if method == reqMethod || method == http.MethodOptions {
-				continue
-			}
+// rejects reports whether the routes registered for the method and the path of
+// the leaf are all restricted, e.g. with Validate, and none of them matches the
+// request. The leaf then does not count as a match and the lookup continues,
+// before the middleware or the Gate see the request.
+func (r *Router) rejects(req *http.Request, method string, leaf *node, ps *Params) bool {
+	if !r.restricted {
+		return false
+	}
+	rt := r.routes[method][leaf.fullPath]
+	if rt == nil || !rt.discriminated() {
+		return false
+	}
+	return rt.choose(req, derefParams(ps)) == nil
+}
 
-			handle, _, _ := r.trees[method].getValue(path, nil)
-			if handle != nil {
-				// Add request method to list of allowed methods
-				allowed = append(allowed, method)
-			}
+// isExactForAny reports whether the path matches a route for any method, which
+// was registered with Exact.
+func (r *Router) isExactForAny(path string) bool {
+	for method := range r.trees {
+		if r.isExact(method, path) {
+			return true
 		}
 	}
+	return false
+}
 
-	if len(allowed) > 0 {
-		// Add request method to list of allowed methods
-		allowed = append(allowed, http.MethodOptions)
+// HandleErr registers a new error-returning request handle with the given path
+// and method. Errors returned by the handle are passed to the ErrorResponder.
+func (r *Router) HandleErr(method, path string, handle HandleE) *Route {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	return r.Handle(method, path,
+		func(w http.ResponseWriter, req *http.Request, ps Params) {
+			if err := handle(w, req, ps); err != nil {
+				r.respondError(w, req, err)
+			}
+		},
+	)
+}
 
-		// Sort allowed methods.
-		// sort.Strings(allowed) unfortunately causes unnecessary allocations
-		// due to allowed being moved to the heap and interface conversion
-		for i, l := 1, len(allowed); i < l; i++ {
-			for j := i; j > 0 && allowed[j] < allowed[j-1]; j-- {
-				allowed[j], allowed[j-1] = allowed[j-1], allowed[j]
+func (r *Router) respondError(w http.ResponseWriter, req *http.Request, err error) {
+	if r.ErrorResponder != nil {
+		r.ErrorResponder(w, req, err)
+	} else {
+		http.Error(w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+	}
+}
+
+// TryHandle is like Handle, but returns an error instead of panicking if the
+// route can not be registered, e.g. because it is invalid or conflicts with an
+// existing route. The error is of type *RouteError.
+func (r *Router) TryHandle(method, path string, handle Handle) (route *Route, err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			route = nil
+			rcvErr, ok := rcv.(error)
+			if !ok {
+				rcvErr = fmt.Errorf("%v", rcv)
+			}
+			err = &RouteError{
+				Method: method,
+				Path:   path,
+				Err:    rcvErr,
 			}
 		}
+	}()
+	return r.Handle(method, path, handle), nil
+}
 
-		// return as comma separated list
-		return strings.Join(allowed, ", ")
-	}
+// ErrTooManyRoutes is the error when registering a route would exceed
+// Router.MaxRoutes.
+var ErrTooManyRoutes = errors.New("too many routes")
+
+// ErrFrozen is the error when registering a route on a router after Freeze.
+var ErrFrozen = errors.New("router is frozen")
+
+// Freeze marks the routes of the router as complete, e.g. once startup is
+// done. Registering further routes afterwards panics with ErrFrozen, which
+// TryHandle and Register return instead, to catch accidental late
+// registrations. Serving requests is not affected.
+// Since the routing table of a frozen router can not change anymore, it may be
+// read concurrently without synchronization, e.g. by Lookup and Routes while
+// requests are served. Middleware can still be changed with Use and the like,
+// and routes can still be disabled and enabled.
+func (r *Router) Freeze() {
+	r.frozen = true
+}
 
-	return allow
+// RouteDef is the declarative definition of a route, see Router.Register.
+type RouteDef struct {
+	Method string
+	Path   string
+	Handle Handle
 }
 
-// ServeHTTP makes the router implement the http.Handler interface.
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if r.PanicHandler != nil {
-		defer r.recv(w, req)
+// Register registers all given routes, e.g. from a generated route table.
+// In contrast to Handle, it does not panic on the first invalid route, but
+// registers all valid routes and returns an error of type RouteErrors listing
+// all routes which could not be registered.
+func (r *Router) Register(routes []RouteDef) error {
+	var errs RouteErrors
+	for _, def := range routes {
+		if _, err := r.TryHandle(def.Method, def.Path, def.Handle); err != nil {
+			errs = append(errs, err.(*RouteError))
+		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-	//path := req.URL.Path
-	path := strings.Split(req.RequestURI, "?")[0]
+// RouteError describes why a route could not be registered.
+type RouteError struct {
+	Method string
+	Path   string
+	Err    error
+}
 
-	if root := r.trees[req.Method]; root != nil {
-		if handle, ps, tsr := root.getValue(path, r.getParams); handle != nil {
-			if ps != nil {
-				handle(w, req, *ps)
-				r.putParams(ps)
-			} else {
-				handle(w, req, nil)
-			}
-			return
-		} else if req.Method != http.MethodConnect && path != "/" {
-			// Moved Permanently, request with GET method
-			code := http.StatusMovedPermanently
-			if req.Method != http.MethodGet {
-				// Permanent Redirect, request with same method
-				code = http.StatusPermanentRedirect
-			}
+func (e *RouteError) Error() string {
+	return e.Method + " " + e.Path + ": " + e.Err.Error()
+}
 
-			if tsr && r.RedirectTrailingSlash {
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					req.URL.Path = path[:len(path)-1]
-				} else {
-					req.URL.Path = path + "/"
-				}
-				http.Redirect(w, req, req.URL.String(), code)
-				return
-			}
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
 
-			// Try to fix the request path
-			if r.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
-					CleanPath(path),
-					r.RedirectTrailingSlash,
-				)
-				if found {
-					req.URL.Path = fixedPath
-					http.Redirect(w, req, req.URL.String(), code)
-					return
-				}
-			}
+// RouteErrors is a list of routes which could not be registered.
+type RouteErrors []*RouteError
+
+func (errs RouteErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// blankParam is the name of params which match like any other param, but
+// whose value is not stored in the Params, see translateBlank.
+const blankParam = "_"
+
+// translateBlank translates segments consisting of a single '_', which match
+// any one segment without capturing it, to the blank param :_.
+func translateBlank(path string) string {
+	if !strings.Contains(path, "/_") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if seg == blankParam {
+			segments[i] = ":" + blankParam
 		}
 	}
+	return strings.Join(segments, "/")
+}
 
-	if req.Method == http.MethodOptions && r.HandleOPTIONS {
-		// Handle OPTIONS requests
-		if allow := r.allowed(path, http.MethodOptions); allow != "" {
-			w.Header().Set("Allow", allow)
-			if r.GlobalOPTIONS != nil {
-				r.GlobalOPTIONS.ServeHTTP(w, req)
-			}
-			return
+// untranslateBlank translates blank params back to segments consisting of a
+// single '_', the syntax by which they are registered, see translateBlank.
+func untranslateBlank(path string) string {
+	if !strings.Contains(path, "/:"+blankParam) {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if seg == ":"+blankParam {
+			segments[i] = blankParam
 		}
-	} else if r.HandleMethodNotAllowed { // Handle 405
-		if allow := r.allowed(path, req.Method); allow != "" {
-			w.Header().Set("Allow", allow)
-			if r.MethodNotAllowed != nil {
-				r.MethodNotAllowed.ServeHTTP(w, req)
-			} else {
-				http.Error(w,
-					http.StatusText(http.StatusMethodNotAllowed),
-					http.StatusMethodNotAllowed,
+	}
+	return strings.Join(segments, "/")
+}
+
+// translateBraces translates parameters in brace syntax, {name} and
+// {name...}, to the native syntax, :name and *name.
+func translateBraces(path string) string {
+	if strings.IndexByte(path, '{') < 0 {
+		return path
+	}
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] != '{' {
+			buf = append(buf, path[i])
+			continue
+		}
+
+		end := strings.IndexByte(path[i:], '}')
+		if end < 0 {
+			panic("unclosed brace in path '" + path + "'")
+		}
+		name := path[i+1 : i+end]
+		if strings.HasSuffix(name, "...") {
+			buf = append(buf, '*')
+			buf = append(buf, name[:len(name)-3]...)
+		} else {
+			buf = append(buf, ':')
+			buf = append(buf, name...)
+		}
+		i += end
+	}
+	return string(buf)
+}
+
+// paramLimit is a length limit or an arity of a param, see parseParamLimits.
+// A value of 0 means the limit is not set.
+type paramLimit struct {
+	wildcard string
+	max      int
+	arity    int
+}
+
+// parseParamLimits strips length limits of the form {max=N} following params
+// from the path, e.g. /users/:id{max=36}, and returns them.
+// With BraceSyntax, limits may also follow params in brace syntax, e.g.
+// /users/{id}{max=36}.
+// Arities are stripped as well, see parseParamArities.
+func parseParamLimits(path string) (string, []paramLimit) {
+	const marker = "{max="
+	if !strings.Contains(path, marker) {
+		return parseParamArities(path, nil)
+	}
+
+	var limits []paramLimit
+	for {
+		i := strings.Index(path, marker)
+		if i < 0 {
+			return parseParamArities(path, limits)
+		}
+		end := strings.IndexByte(path[i:], '}')
+		if end < 0 {
+			panic("unclosed length limit in path '" + path + "'")
+		}
+		end += i
+		max, err := strconv.Atoi(path[i+len(marker) : end])
+		if err != nil || max < 1 {
+			panic("invalid length limit in path '" + path + "'")
+		}
+
+		// Find the param preceding the limit
+		start := strings.LastIndexByte(path[:i], '/') + 1
+		seg := path[start:i]
+		var name string
+		if j := strings.IndexByte(seg, ':'); j >= 0 {
+			name = seg[j+1:]
+		} else if j := strings.LastIndexByte(seg, '{'); j >= 0 && strings.HasSuffix(seg, "}") {
+			name = seg[j+1 : len(seg)-1]
+		}
+		if j := strings.IndexByte(name, '['); j >= 0 {
+			name = name[:j] // arity, e.g. :id[2]{max=36}
+		}
+		if name == "" || strings.HasSuffix(name, "...") {
+			panic("length limit must follow a named parameter in path '" + path + "'")
+		}
+
+		limits = append(limits, paramLimit{wildcard: ":" + name, max: max})
+		path = path[:i] + path[end+1:]
+	}
+}
+
+// parseParamArities strips arities of the form [N] directly following param
+// names from the path, e.g. /point/:coords[2] or /point/{coords}[2], and
+// appends them to limits. A param with an arity only matches path segments
+// consisting of N comma separated values, e.g. /point/12,34.
+func parseParamArities(path string, limits []paramLimit) (string, []paramLimit) {
+	if !strings.Contains(path, "]") {
+		return path, limits
+	}
+
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		open := strings.IndexByte(seg, '[')
+		if open < 1 || !strings.HasSuffix(seg, "]") {
+			continue
+		}
+
+		// Find the param preceding the arity
+		var name string
+		if j := strings.IndexByte(seg, ':'); j >= 0 && j < open {
+			name = seg[j+1 : open]
+		} else if seg[0] == '{' && seg[open-1] == '}' {
+			name = seg[1 : open-1]
+		} else if seg[0] != '*' {
+			continue // static segment
+		}
+		if name == "" || strings.HasSuffix(name, "...") || strings.ContainsAny(name, "{}") {
+			panic("arity must directly follow a named parameter in path '" + path + "'")
+		}
+		arity, err := strconv.Atoi(seg[open+1 : len(seg)-1])
+		if err != nil || arity < 1 {
+			panic("invalid arity in path '" + path + "'")
+		}
+
+		limits = append(limits, paramLimit{wildcard: ":" + name, arity: arity})
+		segs[i] = seg[:open]
+	}
+	return strings.Join(segs, "/"), limits
+}
+
+// parseParamDefaults strips default values of the form :name=value from the
+// trailing params of the path, e.g. /list/:page=1, and returns them in path
+// order. Defaults are only allowed for params following all params without a
+// default and spanning a whole segment.
+func parseParamDefaults(path string) (string, Params) {
+	var defaults Params
+	segs := strings.Split(path, "/")
+	trailing := true
+	for i := len(segs) - 1; i > 0; i-- {
+		seg := segs[i]
+		end := strings.IndexAny(seg, "{[")
+		if end < 0 {
+			end = len(seg)
+		}
+		eq := strings.IndexByte(seg[:end], '=')
+		if eq < 0 || seg[0] != ':' {
+			trailing = false
+			continue
+		}
+		if !trailing {
+			panic("default values are only allowed for trailing parameters in path '" + path + "'")
+		}
+		if eq == 1 {
+			panic("default value must follow a named parameter in path '" + path + "'")
+		}
+		defaults = append(Params{{Key: seg[1:eq], Value: seg[eq+1 : end]}}, defaults...)
+		segs[i] = seg[:eq] + seg[end:]
+	}
+	return strings.Join(segs, "/"), defaults
+}
+
+// handleDefaults registers the handle for the path, whose trailing params have
+// the given default values, and for each shorter path omitting some of them.
+// Requests for a shorter path are served by the route for the full path with
+// the default values of the omitted params.
+func (r *Router) handleDefaults(method, path string, defaults Params, handle Handle) *Route {
+	route := r.Handle(method, path, handle)
+	full := route.path
+
+	short := path
+	for i := len(defaults) - 1; i >= 0; i-- {
+		short = short[:strings.LastIndexByte(short, '/')]
+		injected := defaults[i:]
+		shortPath := short
+		if shortPath == "" {
+			shortPath = "/"
+		}
+		r.Handle(method, shortPath, func(w http.ResponseWriter, req *http.Request, ps Params) {
+			ps = append(ps[:len(ps):len(ps)], injected...)
+			r.routes[method][full].serve(w, req, ps)
+		})
+	}
+	return route
+}
+
+// applyParamLimits sets the length limits of the params of the registered path
+// on their nodes in the tree. Since the nodes are shared by all routes with the
+// same prefix, the limits then apply to all of them.
+// If set is false, it only checks that no different limits were set before.
+func applyParamLimits(root *node, path string, limits []paramLimit, set bool) {
+	for _, limit := range limits {
+		n := root.wildcardNode(path, limit.wildcard)
+		if n == nil {
+			continue
+		}
+		if limit.max > 0 {
+			if n.maxLen != 0 && n.maxLen != limit.max {
+				panic("conflicting length limits for '" + limit.wildcard + "' in path '" + path + "'")
+			}
+			if set {
+				n.maxLen = limit.max
+			}
+		}
+		if limit.arity > 0 {
+			if n.arity != 0 && n.arity != limit.arity {
+				panic("conflicting arities for '" + limit.wildcard + "' in path '" + path + "'")
+			}
+			if set {
+				n.arity = limit.arity
+			}
+		}
+	}
+}
+
+// routesConflict reports whether two different route paths are ambiguous, i.e.
+// if they have different params or a catch-all and another path segment at the
+// same position after a common prefix, or if they match the same request paths
+// with a static path segment of one where the other has a param. The latter
+// can coexist, the static segment then takes precedence.
+func routesConflict(a, b string) bool {
+	overlap := false
+	for a != b {
+		var segA, segB string
+		segA, a = nextSegment(a)
+		segB, b = nextSegment(b)
+		switch {
+		case segA == "" || segB == "":
+			return false
+		case segA == segB:
+		case segA[0] == '*' || segB[0] == '*':
+			return true
+		case segA[0] == ':' && segB[0] == ':':
+			return true
+		case segA[0] == ':' || segB[0] == ':':
+			overlap = true
+		default:
+			return false
+		}
+	}
+	return overlap
+}
+
+// nextSegment splits the path after its leading '/' into the first path segment
+// and the rest, starting with the next '/'.
+func nextSegment(path string) (seg, rest string) {
+	if len(path) < 2 {
+		return "", ""
+	}
+	path = path[1:]
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+// Handler is an adapter which allows the usage of an http.Handler as a
+// request handle.
+// The Params are available in the request context under ParamsKey.
+func (r *Router) Handler(method, path string, handler http.Handler) *Route {
+	return r.Handle(method, path,
+		func(w http.ResponseWriter, req *http.Request, p Params) {
+			if len(p) > 0 {
+				ctx := req.Context()
+				ctx = context.WithValue(ctx, ParamsKey, p)
+				req = req.WithContext(ctx)
+			}
+			handler.ServeHTTP(w, req)
+		},
+	)
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handle.
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) *Route {
+	return r.Handler(method, path, handler)
+}
+
+// HandleStd registers a standard http.HandlerFunc for handlers which don't need
+// the Params argument. It is equivalent to HandlerFunc.
+// The Params are available in the request context under ParamsKey.
+func (r *Router) HandleStd(method, path string, h http.HandlerFunc) *Route {
+	return r.Handler(method, path, h)
+}
+
+// Mount registers the handler for requests with a path under the given path
+// for all methods, like Any, e.g. to delegate to a sub-application.
+// The path must end with a catch-all parameter, e.g. /tenant/:t/*rest. The
+// handler receives the request with its path reduced to the value of the
+// catch-all parameter, e.g. /users/7 for /tenant/acme/users/7, while the
+// Params, including the one of the mount path like t, are available in the
+// request context under ParamsKey, see ParamsFromContext.
+func (r *Router) Mount(path string, handler http.Handler) *Route {
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+	pattern := path
+	if r.BraceSyntax {
+		pattern = translateBraces(pattern)
+	}
+	i := strings.LastIndex(pattern, "/*")
+	if i < 0 || strings.IndexByte(pattern[i+1:], '/') >= 0 {
+		panic("path must end with a catch-all parameter in path '" + path + "'")
+	}
+	name := pattern[i+2:]
+	depth := strings.Count(pattern[:i], "/") + 1
+
+	return r.Any(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
+		req = mountRequest(req, depth, ps.ByName(name))
+		if len(ps) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), ParamsKey, ps))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// WrapHandle is an adapter which allows the usage of a request handle as an
+// http.HandlerFunc, e.g. with middleware for http.Handler.
+// It is the reverse of Handler: the Params are taken from the request context
+// under ParamsKey, or are nil if none are stored there.
+func WrapHandle(h Handle) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		h(w, req, ParamsFromContext(req.Context()))
+	}
+}
+
+// ServeFiles serves files from the given file system root.
+// The path must end with "/*filepath", files are then served from the local
+// path /defined/root/dir/*filepath.
+// For example if root is "/etc" and *filepath is "passwd", the local file
+// "/etc/passwd" would be served.
+// Internally a http.FileServer is used, therefore http.NotFound is used instead
+// of the Router's NotFound handler. Range requests are supported, e.g. for
+// video streaming, and answered with status code 206 and a Content-Range header.
+// To use the operating system's file system implementation,
+// use http.Dir:
+//     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
+// See ServeFilesWithOptions for further options.
+func (r *Router) ServeFiles(path string, root http.FileSystem) {
+	r.ServeFilesWithOptions(path, root, FileServeOptions{})
+}
+
+// middlewareStack holds the registered middleware. It is never modified once
+// stored in Router.mws, but replaced by a modified copy, so that requests can
+// compose their chain while middleware is added or cleared.
+type middlewareStack struct {
+	global []func(Handle) Handle
+	method map[string][]func(Handle) Handle
+	prefix []prefixMiddleware
+}
+
+// Returns the currently registered middleware, which may be nil.
+func (r *Router) middleware() *middlewareStack {
+	mws, _ := r.mws.Load().(*middlewareStack)
+	return mws
+}
+
+// Returns a copy of the currently registered middleware for modification.
+func (r *Router) copyMiddleware() *middlewareStack {
+	mws := &middlewareStack{method: make(map[string][]func(Handle) Handle)}
+	if old := r.middleware(); old != nil {
+		mws.global = append(mws.global, old.global...)
+		for method, m := range old.method {
+			mws.method[method] = append([]func(Handle) Handle(nil), m...)
+		}
+		mws.prefix = append(mws.prefix, old.prefix...)
+	}
+	return mws
+}
+
+// Use adds middleware which wraps every matched handle.
+// Middleware is applied in the order it was added, i.e. the first added
+// middleware is the outermost one and runs first.
+// It is not applied to the NotFound, MethodNotAllowed and automatic OPTIONS
+// handlers.
+func (r *Router) Use(mw ...func(Handle) Handle) {
+	mws := r.copyMiddleware()
+	mws.global = append(mws.global, mw...)
+	r.mws.Store(mws)
+}
+
+// UseFirst is like Use, but prepends the middleware to the middleware added
+// before, so that it is the outermost one and runs before all of it.
+// Among themselves the given middleware keeps its order. For example after
+//
+//	router.Use(a)
+//	router.UseFirst(b, c)
+//	router.UseFirst(d)
+//
+// the middleware runs in the order d, b, c, a.
+func (r *Router) UseFirst(mw ...func(Handle) Handle) {
+	mws := r.copyMiddleware()
+	mws.global = append(append([]func(Handle) Handle(nil), mw...), mws.global...)
+	r.mws.Store(mws)
+}
+
+// UseFor adds middleware which only wraps handles matched for requests with the
+// given method, e.g. a CSRF check for state-changing methods.
+// Method-specific middleware runs inside the global middleware added with Use,
+// i.e. the order is: Use middleware, UseFor middleware, handle.
+// Among themselves the middleware is applied in the order it was added.
+func (r *Router) UseFor(method string, mw ...func(Handle) Handle) {
+	if method == "" {
+		panic("method must not be empty")
+	}
+	mws := r.copyMiddleware()
+	mws.method[method] = append(mws.method[method], mw...)
+	r.mws.Store(mws)
+}
+
+type prefixMiddleware struct {
+	prefix string
+	mw     func(Handle) Handle
+}
+
+// UsePrefix adds middleware which only wraps handles of routes whose path
+// starts with the given prefix, e.g. an authorization check for all routes
+// under /admin, including routes registered before.
+// The prefix is matched against the route path, not the request path, at
+// segment boundaries: the prefix /admin matches the routes /admin and
+// /admin/users, but not /administrator. A prefix ending with '/' matches
+// only routes below it.
+// Prefix middleware runs inside the middleware added with Use and UseFor,
+// the middleware for shorter prefixes first. Among middleware with the same
+// prefix it is applied in the order it was added.
+func (r *Router) UsePrefix(prefix string, mw ...func(Handle) Handle) {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	mws := r.copyMiddleware()
+	for _, m := range mw {
+		// Keep the middleware sorted by prefix length, shortest first
+		i := len(mws.prefix)
+		for i > 0 && len(mws.prefix[i-1].prefix) > len(prefix) {
+			i--
+		}
+		mws.prefix = append(mws.prefix, prefixMiddleware{})
+		copy(mws.prefix[i+1:], mws.prefix[i:])
+		mws.prefix[i] = prefixMiddleware{prefix, m}
+	}
+	r.mws.Store(mws)
+}
+
+// MiddlewareCount returns the number of middleware added with Use, UseFirst,
+// UseFor and UsePrefix.
+func (r *Router) MiddlewareCount() int {
+	mws := r.middleware()
+	if mws == nil {
+		return 0
+	}
+	n := len(mws.global) + len(mws.prefix)
+	for _, m := range mws.method {
+		n += len(m)
+	}
+	return n
+}
+
+// ClearMiddleware removes all middleware, e.g. to rebuild the middleware on a
+// configuration reload.
+// It is safe to call ClearMiddleware, as well as Use, UseFirst, UseFor and
+// UsePrefix, while requests are served. Requests in flight keep the
+// middleware chain they started with.
+func (r *Router) ClearMiddleware() {
+	r.mws.Store(&middlewareStack{})
+}
+
+// Reports whether the route path lies under the prefix.
+func underPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || prefix[len(prefix)-1] == '/' || path[len(prefix)] == '/'
+}
+
+// Wraps the handle with the global, method-specific and prefix middleware.
+func (mws *middlewareStack) apply(method, pattern string, handle Handle) Handle {
+	for i := len(mws.prefix) - 1; i >= 0; i-- {
+		if pm := mws.prefix[i]; underPrefix(pattern, pm.prefix) {
+			handle = pm.mw(handle)
+		}
+	}
+	m := mws.method[method]
+	for i := len(m) - 1; i >= 0; i-- {
+		handle = m[i](handle)
+	}
+	for i := len(mws.global) - 1; i >= 0; i-- {
+		handle = mws.global[i](handle)
+	}
+	return handle
+}
+
+// serveHandle invokes the handle matched for the route pattern, wrapped in the
+// registered middleware, and releases the params afterwards.
+// Params stored in the request context by an enclosing router are appended
+// to the matched params.
+func (r *Router) serveHandle(w http.ResponseWriter, req *http.Request, handle Handle, pattern string, ps *Params) {
+	if r.PanicHandler2 != nil {
+		defer r.recvRoute(w, req, pattern)
+	}
+	if r.SkipCanceledRequests && req.Context().Err() != nil {
+		r.putParams(ps)
+		return
+	}
+	if r.CORS != nil {
+		r.CORS.setOriginHeaders(w, req)
+	}
+	if r.Gate != nil && !r.Gate(w, req, pattern) {
+		r.putParams(ps)
+		return
+	}
+	if r.SaveMatchedRoutePath {
+		if ps == nil && r.paramsPool.New != nil {
+			ps = r.getParams()
+		} else if ps == nil {
+			ps = new(Params)
+		}
+		*ps = append(*ps, Param{Key: MatchedRoutePathParam, Value: pattern})
+	}
+	if mws := r.middleware(); mws != nil {
+		handle = mws.apply(req.Method, pattern, handle)
+	}
+	if r.MaxBodyBytes > 0 {
+		handle = MaxBodyBytes(r.MaxBodyBytes)(handle)
+	}
+	if ps != nil {
+		handle(w, req, inheritParams(req, *ps))
+		r.putParams(ps)
+	} else {
+		handle(w, req, inheritParams(req, nil))
+	}
+}
+
+// inheritParams appends the params stored in the request context, e.g. by an
+// enclosing router, to the given params, so that the params of the matched
+// route keep their indices. The path of the route matched by the enclosing
+// router is not inherited, see SaveMatchedRoutePath.
+// The returned slice never shares its backing array with the inherited params.
+func inheritParams(req *http.Request, ps Params) Params {
+	parent := ParamsFromContext(req.Context())
+	if len(parent) == 0 {
+		return ps
+	}
+	merged := make(Params, 0, len(ps)+len(parent))
+	merged = append(merged, ps...)
+	for _, p := range parent {
+		if p.Key != MatchedRoutePathParam {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// withParams returns a shallow copy of the request with the params stored in
+// its context under ParamsKey.
+func withParams(req *http.Request, ps Params) *http.Request {
+	return req.WithContext(ContextWithParams(req.Context(), ps))
+}
+
+// ServeFile serves the single file name from the given file system at the
+// exact path, e.g. for /favicon.ico or /robots.txt. Unlike ServeFiles, no
+// catch-all parameter is required.
+// Handles are registered for GET and HEAD requests. The file is served with
+// http.ServeContent, which sets the Content-Type and handles conditional and
+// range requests.
+// If the file can not be opened, http.NotFound is used instead of the Router's
+// NotFound handler.
+//     router.ServeFile("/favicon.ico", http.Dir("/var/www"), "favicon.ico")
+func (r *Router) ServeFile(path string, fs http.FileSystem, name string) {
+	handle := func(w http.ResponseWriter, req *http.Request, _ Params) {
+		if !serveContent(w, req, fs, name) {
+			http.NotFound(w, req)
+		}
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// PanicInfo describes a panic recovered from a http handler.
+type PanicInfo struct {
+	// The value passed to panic
+	Value interface{}
+
+	// The path of the matched route, e.g. /user/:name, or an empty string if
+	// the panic did not occur in the handle of a route
+	Pattern string
+}
+
+func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
+	if rcv := recover(); rcv != nil {
+		if rp, ok := rcv.(repanic); ok {
+			// already handled by recvRoute
+			panic(rp.value)
+		}
+		r.handlePanic(w, req, PanicInfo{Value: rcv})
+		if r.RepanicAfterHandler {
+			panic(rcv)
+		}
+	}
+}
+
+// Like recv, but for panics in the handle of the route with the given pattern.
+// It is always called within recv.
+func (r *Router) recvRoute(w http.ResponseWriter, req *http.Request, pattern string) {
+	if rcv := recover(); rcv != nil {
+		r.handlePanic(w, req, PanicInfo{Value: rcv, Pattern: pattern})
+		if r.RepanicAfterHandler {
+			panic(repanic{rcv})
+		}
+	}
+}
+
+// repanic wraps a panic value which was already passed to the panic handler
+// and is re-panicked, see Router.RepanicAfterHandler.
+type repanic struct {
+	value interface{}
+}
+
+func (r *Router) handlePanic(w http.ResponseWriter, req *http.Request, info PanicInfo) {
+	if r.PanicHandler2 != nil {
+		r.PanicHandler2(w, req, info)
+	} else {
+		r.PanicHandler(w, req, info.Value)
+	}
+}
+
+// Lookup allows the manual lookup of a method + path combo.
+// This is e.g. useful to build a framework around this router.
+// If the path was found, it returns the handle function and the path parameter
+// values. Otherwise the third return value indicates whether a redirection to
+// the same path with an extra / without the trailing slash should be performed.
+func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
+	if root := r.trees[method]; root != nil {
+		leaf, ps, tsr := root.lookup(path, r.getParams, r.flags())
+		if leaf == nil {
+			r.putParams(ps)
+			return nil, nil, tsr
+		}
+		if ps == nil {
+			return leaf.handle, nil, tsr
+		}
+		return leaf.handle, *ps, tsr
+	}
+	return nil, nil, false
+}
+
+// HasRoute reports whether a route is registered for the given method and
+// the exact path pattern, e.g. to skip duplicates instead of recovering from
+// the panic of Handle. It does not report whether a request would match:
+// /a/:b and /a/:c are different patterns.
+// Routes registered with Any are registered for no particular method.
+// Length limits, arities and default values of params are not part of the
+// pattern, /a/:b{max=8} is the same pattern as /a/:b.
+func (r *Router) HasRoute(method, path string) bool {
+	if path == "*" {
+		return method == http.MethodOptions && r.serverOPTIONS != nil
+	}
+	return r.routes[method][r.routePattern(path)] != nil
+}
+
+// routePattern returns the pattern under which Handle registers a route for the
+// given path: default values, length limits and arities of params are
+// stripped, and braces and blank params are translated.
+func (r *Router) routePattern(path string) string {
+	if strings.IndexByte(path, '=') >= 0 {
+		path, _ = parseParamDefaults(path)
+	}
+	path, _ = parseParamLimits(path)
+	if r.BraceSyntax {
+		path = translateBraces(path)
+	}
+	return translateBlank(path)
+}
+
+// Disable disables the route registered for the given method and path, e.g.
+// during a maintenance window. Requests matching the route are answered with
+// status code 503 and, if DisabledRetryAfter is set, a Retry-After header,
+// instead of invoking the handle. The route stays registered and can be
+// re-enabled with Enable.
+// The path must be given as registered, see HasRoute. Disable reports whether
+// such a route exists. It is safe to call Disable while requests are served.
+func (r *Router) Disable(method, path string) bool {
+	return r.setDisabled(method, path, 1)
+}
+
+// Enable re-enables a route disabled with Disable. It reports whether a route
+// is registered for the given method and path.
+func (r *Router) Enable(method, path string) bool {
+	return r.setDisabled(method, path, 0)
+}
+
+func (r *Router) setDisabled(method, path string, disabled int32) bool {
+	route := r.routes[method][r.routePattern(path)]
+	if route == nil {
+		return false
+	}
+	atomic.StoreInt32(&route.disabled, disabled)
+	return true
+}
+
+// Answers a request to a disabled route.
+func (r *Router) serveDisabled(w http.ResponseWriter) {
+	if r.DisabledRetryAfter > 0 {
+		secs := int64((r.DisabledRetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	}
+	http.Error(w,
+		http.StatusText(http.StatusServiceUnavailable),
+		http.StatusServiceUnavailable,
+	)
+}
+
+// DumpTree returns an indented text rendering of the routing tree for the
+// given method, one node per line. Each line holds the quoted path prefix of
+// the node, its type (static, root, param or catchAll) and, if a handle is
+// attached, the full route path, e.g.:
+//
+//	"/" <root>
+//	  "user/" <static>
+//	    ":name" <param> [handle /user/:name]
+//
+// Children are listed in lookup order. The output is meant for debugging and
+// is an empty string if no routes are registered for the method.
+func (r *Router) DumpTree(method string) string {
+	root := r.trees[method]
+	if root == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	root.dump(&buf, 0)
+	return buf.String()
+}
+
+// LookupInto is like Lookup, but stores the path parameter values in the slice
+// ps points to, which is only grown if its capacity is too small. Reusing the
+// slice across calls avoids allocations, e.g. for high-frequency dry-run
+// resolution. The values are only valid if a handle was found.
+func (r *Router) LookupInto(method, path string, ps *Params) (Handle, bool) {
+	if cap(*ps) < int(r.maxParams) {
+		*ps = make(Params, 0, r.maxParams)
+	}
+	*ps = (*ps)[:0]
+
+	if root := r.trees[method]; root != nil {
+		leaf, _, tsr := root.lookup(path, func() *Params { return ps }, r.flags())
+		if leaf == nil {
+			return nil, tsr
+		}
+		return leaf.handle, tsr
+	}
+	return nil, false
+}
+
+// LookupRequest is like Lookup, but derives the method and the path from the
+// request exactly as ServeHTTP does, e.g. with RewritePath and
+// CaseInsensitiveMethods, and resolves the route like ServeHTTP, considering
+// routes registered with Any, prefixes and priorities. The request is not
+// modified.
+// This keeps a dry-run resolution consistent with actual serving. No handle is
+// returned for requests which ServeHTTP rejects before the lookup, e.g. because
+// of MaxSegments.
+func (r *Router) LookupRequest(req *http.Request) (Handle, Params, bool) {
+	if live, _ := r.live.Load().(*Router); live != nil && live != r {
+		return live.LookupRequest(req)
+	}
+
+	method, path, _, code := r.requestTarget(req)
+	if code != 0 {
+		return nil, nil, false
+	}
+	if path == "*" && method == http.MethodOptions && r.serverOPTIONS != nil {
+		return r.serverOPTIONS.serve, nil, false
+	}
+
+	var tsr bool
+	if root := r.trees[method]; root != nil {
+		var leaf *node
+		var ps *Params
+		leaf, ps, tsr = root.lookup(path, r.getParams, r.flags())
+		if leaf != nil && r.rejects(req, method, leaf, ps) {
+			r.putParams(ps)
+			leaf, ps = nil, nil
+		}
+		if leaf != nil {
+			if r.prioritized {
+				prio := r.routes[method][leaf.fullPath].priority
+				if handle, fps, ok := r.lookupFallback(req, path, prio); ok {
+					r.putParams(ps)
+					return handle, fps, false
+				}
+			}
+			return leaf.handle, derefParams(ps), false
+		}
+		r.putParams(ps)
+
+		if tsr && r.hasExact && r.isExact(method, toggleTrailingSlash(path)) {
+			tsr = false
+		}
+		if tsr && r.TolerateTrailingSlash && path != "/" {
+			if leaf, ps, _ := root.lookup(toggleTrailingSlash(path), r.getParams, r.flags()); leaf != nil {
+				if !r.rejects(req, method, leaf, ps) {
+					return leaf.handle, derefParams(ps), false
+				}
+				r.putParams(ps)
+			}
+		}
+	}
+
+	if handle, ps, ok := r.lookupFallback(req, path, minPriority); ok {
+		return handle, ps, false
+	}
+	return nil, nil, tsr
+}
+
+// requestTarget returns the method and the path by which ServeHTTP routes the
+// request, after CaseInsensitiveMethods, RewritePath and the
+// EmptySegmentPolicy are applied, and whether the path differs from the path
+// of the request. If the request is rejected before the lookup, e.g. because
+// of StrictUnescape or MaxSegments, code is the status code of the response.
+func (r *Router) requestTarget(req *http.Request) (method, path string, rewritten bool, code int) {
+	method = req.Method
+	if r.CaseInsensitiveMethods {
+		method = strings.ToUpper(method)
+	}
+
+	path = requestPath(req)
+
+	if r.RewritePath != nil {
+		if p := r.RewritePath(path); p != path {
+			path = p
+			rewritten = true
+		}
+	}
+
+	if r.StrictUnescape && strings.IndexByte(path, '%') >= 0 {
+		if _, err := pathUnescape(path, false); err != nil {
+			return method, path, rewritten, http.StatusBadRequest
+		}
+	}
+
+	if r.EmptySegmentPolicy == EmptySegmentReject || r.EmptySegmentPolicy == EmptySegmentCollapse {
+		if strings.Contains(path, "//") {
+			if r.EmptySegmentPolicy == EmptySegmentReject {
+				return method, path, rewritten, http.StatusBadRequest
+			}
+			path = collapseSlashes(path)
+			rewritten = true
+		}
+	}
+
+	if r.MaxSegments > 0 && strings.Count(path, "/") > r.MaxSegments {
+		return method, path, rewritten, http.StatusRequestURITooLong
+	}
+	return method, path, rewritten, 0
+}
+
+// derefParams returns the params ps points to, which may be nil.
+func derefParams(ps *Params) Params {
+	if ps == nil {
+		return nil
+	}
+	return *ps
+}
+
+// requestPath returns the path by which the request is routed, which is the
+// raw, still escaped path of the request URI.
+func requestPath(req *http.Request) string {
+	//path := req.URL.Path
+	path := req.RequestURI
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func (r *Router) allowed(path, reqMethod string) (allow string) {
+	if path == "*" || r.ResolveCacheSize <= 0 {
+		return r.computeAllowed(path, reqMethod)
+	}
+	allow, ok := r.cache.getAllow(reqMethod, path)
+	if !ok {
+		allow = r.computeAllowed(path, reqMethod)
+		r.cache.putAllow(reqMethod, path, allow, r.ResolveCacheSize)
+	}
+	return allow
+}
+
+func (r *Router) computeAllowed(path, reqMethod string) (allow string) {
+	allowed := make([]string, 0, 9)
+
+	if path == "*" { // server-wide
+		// empty method is used for internal calls to refresh the cache
+		if reqMethod == "" {
+			for method := range r.trees {
+				if method == http.MethodOptions || method == methodAny {
+					continue
+				}
+				// Add request method to list of allowed methods
+				allowed = append(allowed, method)
+			}
+		} else {
+			return r.globalAllowed
+		}
+	} else { // specific path
+		for method := range r.trees {
+			// Skip the requested method - we already tried this one
+			if method == reqMethod || method == http.MethodOptions || method == methodAny {
+				continue
+			}
+
+			if leaf, _, _ := r.trees[method].lookup(path, nil, r.flags()); leaf != nil {
+				// Add request method to list of allowed methods
+				allowed = append(allowed, method)
+			}
+		}
+	}
+
+	if len(allowed) > 0 {
+		// Add request method to list of allowed methods
+		allowed = append(allowed, http.MethodOptions)
+
+		// Sort allowed methods.
+		// sort.Strings(allowed) unfortunately causes unnecessary allocations
+		// due to allowed being moved to the heap and interface conversion
+		for i, l := 1, len(allowed); i < l; i++ {
+			for j := i; j > 0 && allowed[j] < allowed[j-1]; j-- {
+				allowed[j], allowed[j-1] = allowed[j-1], allowed[j]
+			}
+		}
+
+		// return as comma separated list
+		return strings.Join(allowed, ", ")
+	}
+
+	return allow
+}
+
+// isStandardMethod reports whether the method is defined in RFC 7231 or, in
+// case of PATCH, in RFC 5789.
+func isStandardMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isAutoOPTIONS reports whether the request is an OPTIONS request which is
+// answered automatically.
+func (r *Router) isAutoOPTIONS(req *http.Request) bool {
+	return req.Method == http.MethodOptions && r.HandleOPTIONS
+}
+
+// redirectCode returns the status code for redirects of requests with the
+// given method. All redirects of the router use it. Only GET requests may be
+// redirected with 301 or 302, for which clients may change the method to GET.
+// All other requests, e.g. POST requests with a body, are redirected with the
+// method-preserving codes 308 or 307.
+func (r *Router) redirectCode(method string) int {
+	if r.PermanentRedirects {
+		if method == http.MethodGet {
+			// Moved Permanently, request with GET method
+			return http.StatusMovedPermanently
+		}
+		// Permanent Redirect, request with same method
+		return http.StatusPermanentRedirect
+	}
+	if method == http.MethodGet {
+		// Found
+		return http.StatusFound
+	}
+	// Temporary Redirect, request with same method
+	return http.StatusTemporaryRedirect
+}
+
+// toggleTrailingSlash returns the path with (without) the trailing slash.
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// collapseSlashes returns the path with consecutive slashes collapsed into one.
+func collapseSlashes(path string) string {
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		buf = append(buf, path[i])
+	}
+	return string(buf)
+}
+
+// serveMethodNotAllowed answers the request with status code 405, if
+// HandleMethodNotAllowed is enabled and other methods are allowed for the
+// path. If checkTSR is set, the methods allowed for the path with (without)
+// the trailing slash are considered as well, if RedirectTrailingSlash is
+// enabled.
+// It reports whether the request was answered.
+func (r *Router) serveMethodNotAllowed(w http.ResponseWriter, req *http.Request, path string, checkTSR bool) bool {
+	if !r.HandleMethodNotAllowed {
+		return false
+	}
+	allow := r.allowed(path, req.Method)
+	if allow == "" && checkTSR && r.RedirectTrailingSlash && path != "/" {
+		allow = r.allowed(toggleTrailingSlash(path), req.Method)
+	}
+	if allow == "" {
+		return false
+	}
+
+	w.Header().Set("Allow", allow)
+	if r.MethodNotAllowed != nil {
+		r.MethodNotAllowed.ServeHTTP(w, req)
+	} else {
+		http.Error(w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+	return true
+}
+
+// Swap atomically replaces the routing table used to serve requests with the
+// one of newRouter, e.g. to reload the routes from a configuration file.
+// The new router is built off-path and then swapped in, which is safe while
+// requests are served, unlike registering routes on a live router. Requests
+// in flight continue with the previous routing table, subsequent requests are
+// served by newRouter, including its middleware and configuration.
+// Swap only affects ServeHTTP. Calling r.Swap(r) restores r's own routing
+// table. newRouter must not be modified after it was swapped in.
+func (r *Router) Swap(newRouter *Router) {
+	if newRouter == nil {
+		panic("router must not be nil")
+	}
+	r.live.Store(newRouter)
+}
+
+// InFlight returns the number of requests currently served by the router,
+// including requests passed on to a router swapped in with Swap.
+func (r *Router) InFlight() int {
+	return int(atomic.LoadInt32(&r.inFlight))
+}
+
+// Drain blocks until no requests are served by the router anymore or the
+// context is done, in which case the context's error is returned, e.g. for
+// zero-downtime deploys after the listener was closed.
+// Drain does not stop the router from accepting new requests.
+func (r *Router) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&r.inFlight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// How often Drain checks for requests in flight
+const drainPollInterval = 10 * time.Millisecond
+
+// ServeHTTP makes the router implement the http.Handler interface.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt32(&r.inFlight, 1)
+	defer atomic.AddInt32(&r.inFlight, -1)
+
+	if live, _ := r.live.Load().(*Router); live != nil && live != r {
+		live.ServeHTTP(w, req)
+		return
+	}
+
+	if len(r.DefaultHeaders) > 0 {
+		h := w.Header()
+		for key, values := range r.DefaultHeaders {
+			h[key] = append([]string(nil), values...)
+		}
+	}
+
+	if r.PanicHandler != nil || r.PanicHandler2 != nil {
+		defer r.recv(w, req)
+	}
+
+	method, path, rewritten, code := r.requestTarget(req)
+	if code != 0 {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	req.Method = method
+	if rewritten {
+		req.URL.Path, _ = pathUnescape(path, false)
+		req.URL.RawPath = path
+	}
+
+	if path == "*" && req.Method == http.MethodOptions && r.serverOPTIONS != nil {
+		r.serveHandle(w, req, r.serverOPTIONS.serve, path, nil)
+		return
+	}
+
+	// Params captured before the lookup failed
+	var partial *Params
+
+	if r.ResolveCacheSize > 0 {
+		if e := r.cache.get(req.Method, path); e != nil {
+			ps := e.fill(path, r.getParams, r.DecodePlusAsSpace)
+			r.serveHandle(w, req, e.leaf.handle, e.leaf.fullPath, ps)
+			return
+		}
+	}
+
+	if root := r.trees[req.Method]; root != nil {
+		leaf, ps, tsr := root.lookup(path, r.getParams, r.flags())
+		if leaf != nil && r.rejects(req, req.Method, leaf, ps) {
+			r.putParams(ps)
+			leaf, ps = nil, nil
+		}
+		if leaf != nil {
+			if r.prioritized {
+				prio := r.routes[req.Method][leaf.fullPath].priority
+				if r.serveFallback(w, req, path, prio) {
+					r.putParams(ps)
+					return
+				}
+			} else if r.ResolveCacheSize > 0 && !(r.restricted && r.routes[req.Method][leaf.fullPath].discriminated()) {
+				// Restricted routes are chosen by the request, not only by the path
+				r.cache.put(req.Method, path, leaf, r.ResolveCacheSize)
+			}
+			r.serveHandle(w, req, leaf.handle, leaf.fullPath, ps)
+			return
+		}
+		partial = ps
+
+		if tsr && r.hasExact && r.isExact(req.Method, toggleTrailingSlash(path)) {
+			tsr = false
+		}
+
+		if tsr && r.TolerateTrailingSlash && path != "/" {
+			if leaf, ps, _ := root.lookup(toggleTrailingSlash(path), r.getParams, r.flags()); leaf != nil {
+				if !r.rejects(req, req.Method, leaf, ps) {
+					r.putParams(partial)
+					r.serveHandle(w, req, leaf.handle, leaf.fullPath, ps)
+					return
+				}
+				r.putParams(ps)
+			}
+		}
+
+		if r.serveFallback(w, req, path, minPriority) {
+			return
+		}
+
+		if r.DefaultHandler != nil {
+			r.putParams(partial)
+			r.serveDefault(w, req, path, tsr)
+			return
+		}
+
+		if r.MethodNotAllowedBeforeRedirect && !r.isAutoOPTIONS(req) &&
+			r.serveMethodNotAllowed(w, req, path, !tsr) {
+			r.putParams(partial)
+			return
+		}
+
+		if req.Method != http.MethodConnect && path != "/" {
+			code := r.redirectCode(req.Method)
+
+			if tsr && (r.RewriteTrailingSlash || r.RedirectTrailingSlash) {
+				tsrPath := toggleTrailingSlash(path)
+
+				if r.RewriteTrailingSlash {
+					if leaf, ps, _ := root.lookup(tsrPath, r.getParams, r.flags()); leaf != nil {
+						req.URL.Path, _ = pathUnescape(tsrPath, false)
+						req.URL.RawPath = tsrPath
+						r.serveHandle(w, req, leaf.handle, leaf.fullPath, ps)
+						return
+					}
+				}
+
+				if r.RedirectTrailingSlash {
+					req.URL.Path = tsrPath
+					http.Redirect(w, req, req.URL.String(), code)
+					return
+				}
+			}
+
+			// Try to fix the request path
+			if r.RedirectFixedPath {
+				fixedPath, found := root.findCaseInsensitivePath(
+					CleanPath(path),
+					r.RedirectTrailingSlash,
 				)
+				if found && fixedPath != path && !(r.hasExact && r.isExact(req.Method, fixedPath)) {
+					if r.OnFixedPath != nil {
+						r.OnFixedPath(path, fixedPath)
+					}
+					req.URL.Path = fixedPath
+					http.Redirect(w, req, req.URL.String(), code)
+					return
+				}
 			}
+		}
+	} else if r.serveFallback(w, req, path, minPriority) {
+		return
+	} else if r.UnknownMethodHandler != nil && !isStandardMethod(req.Method) {
+		r.UnknownMethodHandler.ServeHTTP(w, req)
+		return
+	} else if r.DefaultHandler != nil {
+		r.serveDefault(w, req, path, false)
+		return
+	} else if r.MethodNotAllowedBeforeRedirect && !r.isAutoOPTIONS(req) &&
+		r.serveMethodNotAllowed(w, req, path, true) {
+		return
+	}
+
+	// Redirect to the path with (without) the trailing slash, if a route for
+	// it exists only for other methods. The client then receives a 405
+	// response for the corrected path.
+	if r.RedirectTrailingSlash && r.HandleMethodNotAllowed &&
+		!r.MethodNotAllowedBeforeRedirect && !r.isAutoOPTIONS(req) &&
+		req.Method != http.MethodConnect && path != "/" &&
+		r.allowed(path, req.Method) == "" {
+		if tsrPath := toggleTrailingSlash(path); r.allowed(tsrPath, req.Method) != "" &&
+			!(r.hasExact && r.isExactForAny(tsrPath)) {
+			r.putParams(partial)
+			req.URL.Path = tsrPath
+			http.Redirect(w, req, req.URL.String(), r.redirectCode(req.Method))
 			return
 		}
 	}
 
+	if r.isAutoOPTIONS(req) {
+		// Handle OPTIONS requests
+		if allow := r.allowed(path, http.MethodOptions); allow != "" {
+			if r.CORS != nil && isPreflight(req) {
+				r.CORS.servePreflight(w, req, allow)
+				return
+			}
+			w.Header().Set("Allow", allow)
+			if r.GlobalOPTIONS != nil {
+				r.GlobalOPTIONS.ServeHTTP(w, req)
+			}
+			return
+		}
+	} else if r.serveMethodNotAllowed(w, req, path, false) { // Handle 405
+		r.putParams(partial)
+		return
+	}
+
 	// Handle 404
-	if r.NotFound != nil {
-		r.NotFound.ServeHTTP(w, req)
+	// Pass the params captured so far on to chained routers
+	if _, ok := r.notFoundHandler(req.Method).(*Router); ok && partial != nil && len(*partial) > 0 {
+		ps := make(Params, len(*partial))
+		copy(ps, *partial)
+		req = withParams(req, inheritParams(req, ps))
+	}
+	r.putParams(partial)
+	if r.notFoundHandler(req.Method) != nil {
+		req = req.WithContext(context.WithValue(req.Context(), attemptedPathKey{}, CleanPath(path)))
+	}
+	r.handleNotFound(w, req)
+}
+
+// MatchStatus tells why no route matched a request, see MatchStatusFromContext.
+type MatchStatus uint8
+
+const (
+	// No route matches the request path.
+	MatchNone MatchStatus = iota
+	// A route matches the request path for other methods only.
+	MatchOtherMethod
+	// A route matches the request path with (without) a trailing slash.
+	MatchTrailingSlash
+)
+
+type matchStatusKey struct{}
+
+// MatchStatusFromContext returns why no route matched the request, whose
+// context is passed to Router.DefaultHandler. The boolean reports whether the
+// status is available, which is only the case for requests passed to the
+// DefaultHandler.
+func MatchStatusFromContext(ctx context.Context) (MatchStatus, bool) {
+	status, ok := ctx.Value(matchStatusKey{}).(MatchStatus)
+	return status, ok
+}
+
+// serveDefault passes the request, which no route matched, to the
+// DefaultHandler.
+func (r *Router) serveDefault(w http.ResponseWriter, req *http.Request, path string, tsr bool) {
+	status := MatchNone
+	if tsr && path != "/" {
+		status = MatchTrailingSlash
+	} else if r.allowed(path, req.Method) != "" {
+		status = MatchOtherMethod
+	}
+
+	ctx := context.WithValue(req.Context(), matchStatusKey{}, status)
+	ctx = context.WithValue(ctx, attemptedPathKey{}, CleanPath(path))
+	r.DefaultHandler.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// minPriority is lower than the priority of any route.
+const minPriority = -int(^uint(0)>>1) - 1
+
+// serveFallback serves the request with the matching route registered with
+// Any or the prefix registered with PrefixMatch, if its priority is higher than
+// the given one. Prefixes have priority 0. On a tie the route registered with
+// Any wins.
+// It reports whether the request was served.
+func (r *Router) serveFallback(w http.ResponseWriter, req *http.Request, path string, above int) bool {
+	leaf, ps, prefix := r.matchFallback(req, path, above)
+	if leaf != nil {
+		r.serveHandle(w, req, leaf.handle, leaf.fullPath, ps)
+		return true
+	}
+	if prefix != nil {
+		r.servePrefix(w, req, path, prefix)
+		return true
+	}
+	return false
+}
+
+// lookupFallback is like serveFallback, but returns the handle and the params
+// instead of serving the request, see LookupRequest.
+func (r *Router) lookupFallback(req *http.Request, path string, above int) (Handle, Params, bool) {
+	leaf, ps, prefix := r.matchFallback(req, path, above)
+	if leaf != nil {
+		return leaf.handle, derefParams(ps), true
+	}
+	if prefix != nil {
+		rest, _ := pathUnescape(path[len(prefix.prefix):], r.DecodePlusAsSpace)
+		return prefix.handle, Params{{Key: PrefixRestParam, Value: rest}}, true
+	}
+	return nil, nil, false
+}
+
+// matchFallback returns the route registered with Any or the prefix which
+// serveFallback serves the request with, if any.
+func (r *Router) matchFallback(req *http.Request, path string, above int) (leaf *node, ps *Params, prefix *prefixRoute) {
+	if root := r.trees[methodAny]; root != nil {
+		leaf, ps, _ = root.lookup(path, r.getParams, r.flags())
+		if leaf != nil && r.rejects(req, methodAny, leaf, ps) {
+			r.putParams(ps)
+			leaf, ps = nil, nil
+		}
+	}
+	prefix = r.matchPrefix(path)
+	if prefix != nil && 0 <= above {
+		prefix = nil
+	}
+
+	if leaf != nil {
+		if prio := r.routes[methodAny][leaf.fullPath].priority; prio > above && (prefix == nil || prio >= 0) {
+			return leaf, ps, nil
+		}
+	}
+	r.putParams(ps)
+	return nil, nil, prefix
+}
+
+// Returns the NotFound handler for the request method, which may be nil.
+func (r *Router) notFoundHandler(method string) http.Handler {
+	if handler, ok := r.methodNotFound[method]; ok {
+		return handler
+	}
+	return r.NotFound
+}
+
+func (r *Router) handleNotFound(w http.ResponseWriter, req *http.Request) {
+	if notFound := r.notFoundHandler(req.Method); notFound != nil {
+		notFound.ServeHTTP(w, req)
 	} else {
 		http.NotFound(w, req)
 	}
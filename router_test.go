@@ -5,12 +5,19 @@
 package httprouter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 type mockResponseWriter struct{}
@@ -45,6 +52,45 @@ func TestParams(t *testing.T) {
 	}
 }
 
+func TestParamsGet(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"empty", ""},
+	}
+
+	if val, ok := ps.Get("param1"); !ok || val != "value1" {
+		t.Errorf("Wrong value for param1: Got %q, %t", val, ok)
+	}
+	if val, ok := ps.Get("empty"); !ok || val != "" {
+		t.Errorf("Wrong value for present but empty param: Got %q, %t", val, ok)
+	}
+	if val, ok := ps.Get("noKey"); ok || val != "" {
+		t.Errorf("Wrong value for missing param: Got %q, %t", val, ok)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ps.Get("empty")
+	})
+	if allocs > 0 {
+		t.Errorf("Get allocates: %v allocs", allocs)
+	}
+}
+
+func TestParamsMap(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"param2", ""},
+		Param{"param1", "shadowed"},
+	}
+	want := map[string]string{
+		"param1": "value1",
+		"param2": "",
+	}
+	if m := ps.Map(); !reflect.DeepEqual(m, want) {
+		t.Errorf("Wrong map: want %v, got %v", want, m)
+	}
+}
+
 func TestRouter(t *testing.T) {
 	router := New()
 
@@ -357,6 +403,56 @@ func TestRouterOPTIONS(t *testing.T) {
 	}
 }
 
+func TestRouterServerWideOPTIONS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var custom, global bool
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.GlobalOPTIONS = http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		global = true
+	})
+	router.OPTIONS("*", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		custom = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodOptions, "*", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !custom || global {
+		t.Errorf("wrong handler called: custom=%t, global=%t", custom, global)
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "" {
+		t.Errorf("unexpected Allow header: %q", allow)
+	}
+
+	// path specific OPTIONS requests are not affected
+	custom = false
+	r = httptest.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if custom || !global {
+		t.Errorf("wrong handler called: custom=%t, global=%t", custom, global)
+	}
+
+	recv := catchPanic(func() {
+		router.GET("*", handlerFunc)
+	})
+	if recv == nil {
+		t.Error("registering * for GET did not panic")
+	}
+	recv = catchPanic(func() {
+		router.OPTIONS("*", handlerFunc)
+	})
+	if recv == nil {
+		t.Error("registering a duplicate * route did not panic")
+	}
+}
+
 func TestRouterNotAllowed(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -406,6 +502,574 @@ func TestRouterNotAllowed(t *testing.T) {
 	}
 }
 
+func TestRouterRewritePath(t *testing.T) {
+	var id, urlPath string
+	router := New()
+	router.RewritePath = func(path string) string {
+		if strings.HasPrefix(path, "/old/") {
+			return "/new/" + path[len("/old/"):]
+		}
+		return path
+	}
+	router.GET("/new/:id", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		id = ps.ByName("id")
+		urlPath = r.URL.Path
+	})
+
+	tests := []struct {
+		path    string
+		code    int
+		id      string
+		urlPath string
+	}{
+		{"/old/x", http.StatusOK, "x", "/new/x"},
+		{"/old/a%20b", http.StatusOK, "a b", "/new/a b"},
+		{"/new/y", http.StatusOK, "y", "/new/y"},
+		{"/other/z", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		id, urlPath = "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || id != test.id || urlPath != test.urlPath {
+			t.Errorf("%s: want %d %q %q, got %d %q %q",
+				test.path, test.code, test.id, test.urlPath, w.Code, id, urlPath)
+		}
+	}
+}
+
+func TestRouterFileExtensionParam(t *testing.T) {
+	var routed, format string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			format = ps.ByName("format")
+		}
+	}
+
+	router := New()
+	router.GET("/data.:format", handle("data"))
+	router.GET("/data", handle("plain"))
+	router.GET("/reports/:year/summary.:format", handle("summary"))
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+		format string
+	}{
+		{"/data.json", http.StatusOK, "data", "json"},
+		{"/data.xml", http.StatusOK, "data", "xml"},
+		{"/data", http.StatusOK, "plain", ""},
+		{"/data.", http.StatusNotFound, "", ""},
+		{"/data.json/meta", http.StatusNotFound, "", ""},
+		{"/reports/2020/summary.csv", http.StatusOK, "summary", "csv"},
+	}
+	for _, test := range tests {
+		routed, format = "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed || format != test.format {
+			t.Errorf("%s: want %d %q format %q, got %d %q format %q",
+				test.path, test.code, test.routed, test.format, w.Code, routed, format)
+		}
+	}
+}
+
+func TestRouterParamLengthLimit(t *testing.T) {
+	var routed, id string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			id = ps.ByName("id")
+		}
+	}
+
+	router := New()
+	router.GET("/orders/:id{max=36}", handle("order"))
+	router.GET("/orders/:id/items", handle("items"))
+	router.GET("/short/:id{max=3}/x", handle("short"))
+
+	id36 := strings.Repeat("a", 36)
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+		id     string
+	}{
+		{"/orders/" + id36, http.StatusOK, "order", id36},
+		{"/orders/" + id36 + "b", http.StatusNotFound, "", ""},
+		// the limit applies to all routes sharing the param
+		{"/orders/" + id36 + "b/items", http.StatusNotFound, "", ""},
+		{"/orders/" + id36 + "/items", http.StatusOK, "items", id36},
+		{"/short/abc/x", http.StatusOK, "short", "abc"},
+		{"/short/abcd/x", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		routed, id = "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed || id != test.id {
+			t.Errorf("%s: want %d %q id %q, got %d %q id %q",
+				test.path, test.code, test.routed, test.id, w.Code, routed, id)
+		}
+	}
+
+	if !router.HasRoute(http.MethodGet, "/orders/:id") {
+		t.Error("route registered without the length limit")
+	}
+
+	// brace syntax
+	router = New()
+	router.BraceSyntax = true
+	router.GET("/users/{id}{max=4}", handle("user"))
+	for path, code := range map[string]int{"/users/1234": http.StatusOK, "/users/12345": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != code {
+			t.Errorf("%s: want status %d, got %d", path, code, w.Code)
+		}
+	}
+
+	for _, path := range []string{
+		"/x/:id{max=0}",
+		"/x/:id{max=abc}",
+		"/x/:id{max=3",
+		"/x/static{max=3}",
+		"/x/*path{max=3}",
+	} {
+		recv := catchPanic(func() {
+			New().GET(path, handle("invalid"))
+		})
+		if recv == nil {
+			t.Errorf("registering %s did not panic", path)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router := New()
+		router.GET("/x/:id{max=3}", handle("a"))
+		router.GET("/x/:id{max=4}/y", handle("b"))
+	})
+	if recv == nil {
+		t.Error("registering conflicting length limits did not panic")
+	}
+}
+
+func TestRouterRootParam(t *testing.T) {
+	var routed string
+	router := New()
+	router.GET("/:lang/home", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = "home " + ps.ByName("lang")
+	})
+	router.GET("/admin/home", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = "admin"
+	})
+	router.GET("/admin/users", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = "users"
+	})
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+	}{
+		{"/en/home", http.StatusOK, "home en"},
+		{"/admin/home", http.StatusOK, "admin"},
+		{"/admin/users", http.StatusOK, "users"},
+		{"/administrator/home", http.StatusOK, "home administrator"},
+		{"/EN/HOME", http.StatusMovedPermanently, ""},
+		{"/en/home/", http.StatusMovedPermanently, ""},
+		{"/en", http.StatusNotFound, ""},
+		{"/admin", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: want %d %q, got %d %q", test.path, test.code, test.routed, w.Code, routed)
+		}
+	}
+
+	steps := router.Trace(http.MethodGet, "/admin/home")
+	if last := steps[len(steps)-1]; last.Result != TraceMatch || last.Node != "home" {
+		t.Errorf("wrong trace for /admin/home: %+v", steps)
+	}
+	steps = router.Trace(http.MethodGet, "/en/home")
+	if last := steps[len(steps)-2]; last.Result != TraceStatic || last.Node != "/home" {
+		t.Errorf("wrong trace for /en/home: %+v", steps)
+	}
+
+	// A param within a segment or a catch-all still conflicts
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	for _, path := range []string{"/admin:x", "/*filepath"} {
+		if recv := catchPanic(func() { router.GET(path, handle) }); recv == nil {
+			t.Errorf("no panic for conflicting route %q", path)
+		}
+	}
+}
+
+func TestRouterParamAndCatchAll(t *testing.T) {
+	var routed string
+	var ps Params
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, p Params) {
+			routed, ps = name, append(Params(nil), p...)
+		}
+	}
+
+	for _, cacheSize := range []int{0, 16} {
+		router := New()
+		router.ResolveCacheSize = cacheSize
+		router.GET("/users/:id/files/*filepath", handle("files"))
+		router.GET("/users/:id", handle("user"))
+		router.GET("/users/new/files/*filepath", handle("new"))
+
+		tests := []struct {
+			path     string
+			code     int
+			routed   string
+			ps       Params
+			location string
+		}{
+			{"/users/7/files/a/b.txt", http.StatusOK, "files", Params{{"id", "7"}, {"filepath", "/a/b.txt"}}, ""},
+			{"/users/7/files/", http.StatusOK, "files", Params{{"id", "7"}, {"filepath", "/"}}, ""},
+			{"/users/7/files//a", http.StatusOK, "files", Params{{"id", "7"}, {"filepath", "//a"}}, ""},
+			{"/users/7/files", http.StatusMovedPermanently, "", nil, "/users/7/files/"},
+			{"/users/7", http.StatusOK, "user", Params{{"id", "7"}}, ""},
+			{"/users/new/files/a", http.StatusOK, "new", Params{{"filepath", "/a"}}, ""},
+			{"/users//files/a", http.StatusNotFound, "", nil, ""},
+		}
+		// repeated to also hit the resolve cache
+		for i := 0; i < 2; i++ {
+			for _, test := range tests {
+				routed, ps = "", nil
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+				if w.Code != test.code || routed != test.routed || !reflect.DeepEqual(ps, test.ps) {
+					t.Errorf("%s (cache %d): want %d %q %v, got %d %q %v",
+						test.path, cacheSize, test.code, test.routed, test.ps, w.Code, routed, ps)
+				}
+				if location := w.Header().Get("Location"); location != test.location {
+					t.Errorf("%s (cache %d): want Location %q, got %q", test.path, cacheSize, test.location, location)
+				}
+			}
+		}
+	}
+}
+
+func TestRouterParamArity(t *testing.T) {
+	var routed string
+	var coords []string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			coords = ps.Split("coords", ",")
+		}
+	}
+
+	router := New()
+	router.GET("/point/:coords[2]", handle("point"))
+	router.GET("/point/:coords/label", handle("label"))
+	router.GET("/box/:coords[4]{max=9}", handle("box"))
+	router.GET("/file.:coords[1]", handle("file"))
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+		coords []string
+	}{
+		{"/point/12,34", http.StatusOK, "point", []string{"12", "34"}},
+		{"/point/12", http.StatusNotFound, "", nil},
+		{"/point/12,34,56", http.StatusNotFound, "", nil},
+		{"/point/12,", http.StatusOK, "point", []string{"12", ""}},
+		// the arity applies to all routes sharing the param
+		{"/point/12,34/label", http.StatusOK, "label", []string{"12", "34"}},
+		{"/point/12/label", http.StatusNotFound, "", nil},
+		{"/box/1,2,3,4", http.StatusOK, "box", []string{"1", "2", "3", "4"}},
+		{"/box/10,20,30,40", http.StatusNotFound, "", nil},
+		{"/file.txt", http.StatusOK, "file", []string{"txt"}},
+		{"/file.t,xt", http.StatusNotFound, "", nil},
+	}
+	for _, test := range tests {
+		routed, coords = "", nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed || !reflect.DeepEqual(coords, test.coords) {
+			t.Errorf("%s: want %d %q coords %q, got %d %q coords %q",
+				test.path, test.code, test.routed, test.coords, w.Code, routed, coords)
+		}
+	}
+
+	if !router.HasRoute(http.MethodGet, "/point/:coords") {
+		t.Error("route registered without the arity")
+	}
+
+	// brace syntax
+	router = New()
+	router.BraceSyntax = true
+	router.GET("/point/{coords}[2]", handle("point"))
+	for path, code := range map[string]int{"/point/1,2": http.StatusOK, "/point/1": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != code {
+			t.Errorf("%s: want status %d, got %d", path, code, w.Code)
+		}
+	}
+
+	// brackets in static segments are not arities
+	router = New()
+	router.GET("/static[1]", handle("static"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static[1]", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("static path with brackets: want status 200, got %d", w.Code)
+	}
+
+	for _, path := range []string{
+		"/x/:coords[0]",
+		"/x/:coords[a]",
+		"/x/:[2]",
+		"/x/*path[2]",
+	} {
+		recv := catchPanic(func() {
+			New().GET(path, handle("invalid"))
+		})
+		if recv == nil {
+			t.Errorf("registering %s did not panic", path)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router := New()
+		router.GET("/x/:coords[2]", handle("a"))
+		router.GET("/x/:coords[3]/y", handle("b"))
+	})
+	if recv == nil {
+		t.Error("registering conflicting arities did not panic")
+	}
+}
+
+func TestRouterParamDefaults(t *testing.T) {
+	var routed string
+	var ps Params
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, p Params) {
+			routed = name
+			ps = p
+		}
+	}
+
+	router := New()
+	router.GET("/list/:page=1", handle("list"))
+	router.GET("/users/:id/posts/:page=1/:size=20", handle("posts"))
+	router.GET("/orders/:id=0{max=3}", handle("orders")).Validate("id", func(s string) bool {
+		return s != "999"
+	})
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+		ps     Params
+	}{
+		{"/list", http.StatusOK, "list", Params{{"page", "1"}}},
+		{"/list/3", http.StatusOK, "list", Params{{"page", "3"}}},
+		{"/list/", http.StatusMovedPermanently, "", nil},
+		{"/users/7/posts", http.StatusOK, "posts", Params{{"id", "7"}, {"page", "1"}, {"size", "20"}}},
+		{"/users/7/posts/2", http.StatusOK, "posts", Params{{"id", "7"}, {"page", "2"}, {"size", "20"}}},
+		{"/users/7/posts/2/50", http.StatusOK, "posts", Params{{"id", "7"}, {"page", "2"}, {"size", "50"}}},
+		{"/orders", http.StatusOK, "orders", Params{{"id", "0"}}},
+		{"/orders/1234", http.StatusNotFound, "", nil},
+		{"/orders/999", http.StatusNotFound, "", nil},
+	}
+	for _, test := range tests {
+		routed, ps = "", nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed || !reflect.DeepEqual(ps, test.ps) {
+			t.Errorf("%s: want %d %q %v, got %d %q %v",
+				test.path, test.code, test.routed, test.ps, w.Code, routed, ps)
+		}
+	}
+
+	// the route is found by the pattern it was registered with
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if !router.HasRoute(http.MethodGet, "/list/:page=1") {
+		t.Error("HasRoute did not find /list/:page=1")
+	}
+	if !router.Disable(http.MethodGet, "/list/:page=1") {
+		t.Error("Disable did not find /list/:page=1")
+	}
+	if serve("/list") != http.StatusServiceUnavailable || serve("/list/3") != http.StatusServiceUnavailable {
+		t.Error("routes of /list/:page=1 not disabled")
+	}
+	router.Enable(http.MethodGet, "/list/:page=1")
+	router.Alias("/l/:page", "/list/:page=1")
+	routed, ps = "", nil
+	if serve("/l/4") != http.StatusOK || routed != "list" || ps.ByName("page") != "4" {
+		t.Errorf("alias of /list/:page=1: got %q %v", routed, ps)
+	}
+
+	for _, path := range []string{
+		"/x/:a=1/:b",
+		"/x/:=1",
+	} {
+		recv := catchPanic(func() {
+			New().GET(path, handle("invalid"))
+		})
+		if recv == nil {
+			t.Errorf("registering %s did not panic", path)
+		}
+	}
+}
+
+func TestRouterEmptyParamSegment(t *testing.T) {
+	var id string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		id = ps.ByName("id")
+	}
+
+	tests := []struct {
+		routes   []string
+		path     string
+		code     int
+		location string
+		id       string
+	}{
+		// an empty segment never matches a param
+		{[]string{"/user/:id"}, "/user/", http.StatusNotFound, "", ""},
+		{[]string{"/user/:id"}, "/user", http.StatusNotFound, "", ""},
+		{[]string{"/user/:id"}, "/user//", http.StatusNotFound, "", ""},
+		{[]string{"/user/:id/"}, "/user//", http.StatusNotFound, "", ""},
+		{[]string{"/user/:id"}, "/user/x/", http.StatusMovedPermanently, "/user/x", ""},
+		{[]string{"/user/:id"}, "/user/x", http.StatusOK, "", "x"},
+
+		// /user/ is only redirected if /user is registered
+		{[]string{"/user/:id", "/user"}, "/user/", http.StatusMovedPermanently, "/user", ""},
+		{[]string{"/user/:id", "/users"}, "/user/", http.StatusNotFound, "", ""},
+		{[]string{"/user/:id", "/user/:id/:x"}, "/user/x/", http.StatusMovedPermanently, "/user/x", ""},
+	}
+	for _, test := range tests {
+		router := New()
+		for _, route := range test.routes {
+			router.GET(route, handle)
+		}
+
+		id = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || w.Header().Get("Location") != test.location || id != test.id {
+			t.Errorf("%v %s: want %d %q id %q, got %d %q id %q", test.routes, test.path,
+				test.code, test.location, test.id, w.Code, w.Header().Get("Location"), id)
+		}
+	}
+}
+
+func TestRouterTolerateTrailingSlash(t *testing.T) {
+	var routed string
+	var id string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name
+			id = ps.ByName("id")
+		}
+	}
+
+	router := New()
+	router.TolerateTrailingSlash = true
+	router.POST("/users", handle("users"))
+	router.POST("/users/:id", handle("user"))
+	router.POST("/dirs/:id/", handle("dir"))
+
+	tests := []struct {
+		path   string
+		routed string
+		id     string
+	}{
+		{"/users", "users", ""},
+		{"/users/", "users", ""},
+		{"/users/7", "user", "7"},
+		{"/users/7/", "user", "7"},
+		{"/dirs/3/", "dir", "3"},
+		{"/dirs/3", "dir", "3"},
+	}
+	for _, test := range tests {
+		routed, id = "", ""
+		r := httptest.NewRequest(http.MethodPost, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: want status 200, got %d", test.path, w.Code)
+		}
+		if routed != test.routed || id != test.id {
+			t.Errorf("%s: want %s with id %q, got %s with id %q", test.path, test.routed, test.id, routed, id)
+		}
+		if r.URL.Path != test.path {
+			t.Errorf("%s: request path was changed to %s", test.path, r.URL.Path)
+		}
+	}
+}
+
+func TestRouterMethodNotAllowedBeforeRedirect(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.GET("/both", handlerFunc)
+	router.POST("/both/", handlerFunc)
+
+	tests := []struct {
+		beforeRedirect bool
+		method         string
+		path           string
+		code           int
+		location       string
+		allow          string
+	}{
+		// TSR match only under another method
+		{false, http.MethodGet, "/path/", http.StatusMovedPermanently, "/path", ""},
+		{true, http.MethodGet, "/path/", http.StatusMethodNotAllowed, "", "OPTIONS, POST"},
+		{false, http.MethodPut, "/path/", http.StatusPermanentRedirect, "/path", ""},
+		{true, http.MethodPut, "/path/", http.StatusMethodNotAllowed, "", "OPTIONS, POST"},
+
+		// TSR match under the request method
+		{false, http.MethodPost, "/path/", http.StatusPermanentRedirect, "/path", ""},
+		{true, http.MethodPost, "/path/", http.StatusPermanentRedirect, "/path", ""},
+
+		// exact match under another method and TSR match under the request method
+		{false, http.MethodPost, "/both", http.StatusPermanentRedirect, "/both/", ""},
+		{true, http.MethodPost, "/both", http.StatusMethodNotAllowed, "", "GET, OPTIONS"},
+
+		// no match at all
+		{false, http.MethodGet, "/nope/", http.StatusNotFound, "", ""},
+		{true, http.MethodGet, "/nope/", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		router.MethodNotAllowedBeforeRedirect = test.beforeRedirect
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s (beforeRedirect=%t): want status %d, got %d",
+				test.method, test.path, test.beforeRedirect, test.code, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s %s (beforeRedirect=%t): want Location %q, got %q",
+				test.method, test.path, test.beforeRedirect, test.location, got)
+		}
+		if got := w.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s (beforeRedirect=%t): want Allow %q, got %q",
+				test.method, test.path, test.beforeRedirect, test.allow, got)
+		}
+	}
+}
+
 func TestRouterNotFound(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -499,6 +1163,81 @@ func TestRouterPanicHandler(t *testing.T) {
 	}
 }
 
+func TestRouterRedirectPreservesMethod(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		router.Handle(method, "/orders", handlerFunc)
+		router.Handle(method, "/items/", handlerFunc)
+	}
+
+	tests := []struct {
+		route    string
+		location string
+	}{
+		{"/orders/", "/orders"},     // trailing slash
+		{"/items", "/items/"},       // trailing slash
+		{"/ORDERS", "/orders"},      // fixed path
+		{"/a/../orders", "/orders"}, // fixed path
+		{"/orders/?id=1&x=y", "/orders?id=1&x=y"},
+	}
+	for _, permanent := range []bool{true, false} {
+		router.PermanentRedirects = permanent
+		code := http.StatusTemporaryRedirect
+		if permanent {
+			code = http.StatusPermanentRedirect
+		}
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+			for _, test := range tests {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(method, test.route, strings.NewReader("body")))
+				if w.Code != code {
+					t.Errorf("%s %s (permanent=%v): want status %d, got %d", method, test.route, permanent, code, w.Code)
+				}
+				if location := w.Header().Get("Location"); location != test.location {
+					t.Errorf("%s %s: want Location %q, got %q", method, test.route, test.location, location)
+				}
+			}
+		}
+	}
+}
+
+func TestRouterOnFixedPath(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var calls [][2]string
+	router := New()
+	router.OnFixedPath = func(from, to string) {
+		calls = append(calls, [2]string{from, to})
+	}
+	router.GET("/path", handlerFunc)
+	router.GET("/dir/", handlerFunc)
+
+	tests := []struct {
+		route string
+		code  int
+		calls [][2]string
+	}{
+		{"/PATH", http.StatusMovedPermanently, [][2]string{{"/PATH", "/path"}}},
+		{"/a/../path", http.StatusMovedPermanently, [][2]string{{"/a/../path", "/path"}}},
+		{"/path", http.StatusOK, nil},
+		{"/dir", http.StatusMovedPermanently, nil}, // trailing slash redirect
+		{"/other", http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		calls = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: want status %d, got %d", test.route, test.code, w.Code)
+		}
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("%s: want OnFixedPath calls %q, got %q", test.route, test.calls, calls)
+		}
+	}
+}
+
 func TestRouterLookup(t *testing.T) {
 	routed := false
 	wantHandle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
@@ -610,6 +1349,33 @@ func TestRouterParamsFromContext(t *testing.T) {
 	}
 }
 
+func TestNewParams(t *testing.T) {
+	ps := NewParams("user", "gopher", "id", "42")
+	want := Params{{"user", "gopher"}, {"id", "42"}}
+	if !reflect.DeepEqual(ps, want) {
+		t.Errorf("wrong params: want %v, got %v", want, ps)
+	}
+	if ps := NewParams(); len(ps) != 0 {
+		t.Errorf("want no params, got %v", ps)
+	}
+	if recv := catchPanic(func() { NewParams("user") }); recv == nil {
+		t.Error("no panic for odd number of strings")
+	}
+
+	// invoke a handler directly with synthetic params
+	var user, id string
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		ps := ParamsFromContext(req.Context())
+		user, id = ps.ByName("user"), ps.ByName("id")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/gopher/42", nil)
+	req = req.WithContext(ContextWithParams(req.Context(), ps))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if user != "gopher" || id != "42" {
+		t.Errorf("wrong params from context: user=%q id=%q", user, id)
+	}
+}
+
 func TestRouterMatchedRoutePath(t *testing.T) {
 	route1 := "/user/:name"
 	routed1 := false
@@ -697,3 +1463,2084 @@ func TestRouterServeFiles(t *testing.T) {
 		t.Error("serving file failed")
 	}
 }
+
+func TestRouterMaxSegments(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/*path", handlerFunc)
+	router.MaxSegments = 20
+
+	deep := strings.Repeat("/a", 100)
+	r := httptest.NewRequest(http.MethodGet, deep, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestURITooLong {
+		t.Errorf("deep path not rejected: Code=%d", w.Code)
+	}
+
+	shallow := strings.Repeat("/a", 20)
+	r = httptest.NewRequest(http.MethodGet, shallow, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("path within limit rejected: Code=%d", w.Code)
+	}
+
+	// 0 means unlimited
+	router.MaxSegments = 0
+	r = httptest.NewRequest(http.MethodGet, deep, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("deep path rejected without limit: Code=%d", w.Code)
+	}
+}
+
+func TestRouterStrictUnescape(t *testing.T) {
+	var routed bool
+	var id string
+	router := New()
+	router.GET("/user/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = true
+		id = ps.ByName("id")
+	})
+
+	serve := func(uri string) int {
+		routed, id = false, ""
+		// httptest.NewRequest panics for invalid escapes
+		r := &http.Request{
+			Method:     http.MethodGet,
+			RequestURI: uri,
+			URL:        &url.URL{Path: uri},
+			Header:     make(http.Header),
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// By default the path is routed, but the value can not be decoded
+	if code := serve("/user/%zz"); code != http.StatusOK || !routed || id != "" {
+		t.Errorf("non-strict: want 200 with empty id, got %d (routed=%t, id=%q)", code, routed, id)
+	}
+
+	router.StrictUnescape = true
+	for _, uri := range []string{"/user/%zz", "/user/%4", "/user/%", "/us%zzer/1", "/user/1?q=%zz"} {
+		code := serve(uri)
+		want := http.StatusBadRequest
+		if strings.Contains(uri, "?") {
+			want = http.StatusOK // the query is not part of the path
+		}
+		if code != want || (want == http.StatusBadRequest && routed) {
+			t.Errorf("strict %s: want %d, got %d (routed=%t)", uri, want, code, routed)
+		}
+	}
+	if code := serve("/user/%41"); code != http.StatusOK || id != "A" {
+		t.Errorf("strict valid escape: want 200 with id \"A\", got %d (id=%q)", code, id)
+	}
+}
+
+func TestRouterEmptySegmentPolicy(t *testing.T) {
+	var routed, urlPath string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, req *http.Request, ps Params) {
+			routed = name + ps.ByName("x")
+			urlPath = req.URL.Path
+		}
+	}
+
+	tests := []struct {
+		policy   EmptySegmentPolicy
+		path     string
+		code     int
+		routed   string
+		location string
+	}{
+		// empty segments are redirected to the cleaned path by default
+		{EmptySegmentDefault, "/a//b", http.StatusMovedPermanently, "", "/a/b"},
+		{EmptySegmentDefault, "/c//b", http.StatusMovedPermanently, "", "/c/b"},
+		{EmptySegmentDefault, "/files//x", http.StatusOK, "files//x", ""},
+		{EmptySegmentReject, "/a//b", http.StatusBadRequest, "", ""},
+		{EmptySegmentReject, "/files//x", http.StatusBadRequest, "", ""},
+		{EmptySegmentReject, "/a/b/", http.StatusMovedPermanently, "", "/a/b"}, // trailing slash
+		{EmptySegmentCollapse, "/a//b", http.StatusOK, "static", ""},
+		{EmptySegmentCollapse, "/c///b", http.StatusOK, "c/b", ""},
+		{EmptySegmentCollapse, "/files//x", http.StatusOK, "files/x", ""},
+		{EmptySegmentMatch, "/a//b", http.StatusOK, "param", ""},
+		{EmptySegmentMatch, "/c//b", http.StatusOK, "c/b", ""},
+		{EmptySegmentMatch, "/a/x/b", http.StatusOK, "paramx", ""},
+		{EmptySegmentMatch, "/a/b", http.StatusOK, "static", ""},
+	}
+	for _, test := range tests {
+		router := New()
+		router.EmptySegmentPolicy = test.policy
+		router.GET("/a/b", handle("static"))
+		router.GET("/a/:x/b", handle("param"))
+		router.GET("/c/:x", handle("c/"))
+		router.GET("/c/:x/b", handle("c/b"))
+		router.GET("/files/*x", handle("files"))
+
+		routed, urlPath = "", ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("policy %d, %s: want %d %q, got %d %q", test.policy, test.path, test.code, test.routed, w.Code, routed)
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("policy %d, %s: want Location %q, got %q", test.policy, test.path, test.location, location)
+		}
+		if test.policy == EmptySegmentCollapse && urlPath != collapseSlashes(test.path) {
+			t.Errorf("policy %d, %s: request URL path not collapsed: %q", test.policy, test.path, urlPath)
+		}
+	}
+
+	// Trace walks the tree like a request
+	router := New()
+	router.EmptySegmentPolicy = EmptySegmentMatch
+	router.GET("/a/:x/b", handle("param"))
+	steps := router.Trace(http.MethodGet, "/a//b")
+	if last := steps[len(steps)-1]; last.Result != TraceMatch {
+		t.Errorf("wrong trace for /a//b: %+v", steps)
+	}
+}
+
+func TestRouterRewriteTrailingSlash(t *testing.T) {
+	var routed string
+	router := New()
+	router.RewriteTrailingSlash = true
+	router.POST("/path", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		routed = r.URL.Path
+	})
+	router.POST("/dir/:name/", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		routed = r.URL.Path + "|" + ps.ByName("name")
+	})
+
+	testRoutes := []struct {
+		route  string
+		routed string
+	}{
+		{"/path/", "/path"},                    // TSR -/
+		{"/dir/gopher", "/dir/gopher/|gopher"}, // TSR +/
+		{"/dir/a%20b", "/dir/a b/|a b"},        // escaped segment
+	}
+	for _, tr := range testRoutes {
+		routed = ""
+		r := httptest.NewRequest(http.MethodPost, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("rewrite of route %s failed: Code=%d, Header=%v", tr.route, w.Code, w.Header())
+		}
+		if routed != tr.routed {
+			t.Errorf("rewrite of route %s served %q, want %q", tr.route, routed, tr.routed)
+		}
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				trace = append(trace, name)
+				next(w, r, ps)
+			}
+		}
+	}
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		trace = append(trace, "handle")
+	}
+
+	router := New()
+	router.GET("/path", handle)
+	router.POST("/path", handle)
+	router.Use(mw("global1"), mw("global2"))
+	router.UseFor(http.MethodPost, mw("csrf"))
+
+	r := httptest.NewRequest(http.MethodGet, "/path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := []string{"global1", "global2", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware order for GET: want %v, got %v", want, trace)
+	}
+
+	trace = nil
+	r = httptest.NewRequest(http.MethodPost, "/path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := []string{"global1", "global2", "csrf", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware order for POST: want %v, got %v", want, trace)
+	}
+
+	// middleware must not run for unmatched requests
+	trace = nil
+	r = httptest.NewRequest(http.MethodPost, "/nope", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if len(trace) > 0 {
+		t.Errorf("middleware ran for unmatched request: %v", trace)
+	}
+}
+
+func TestParamsIndexOf(t *testing.T) {
+	var ps Params
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.GET("/a/:b/c/:d", func(_ http.ResponseWriter, _ *http.Request, p Params) {
+		ps = append(Params(nil), p...)
+	})
+	router.GET("/files/*filepath", func(_ http.ResponseWriter, _ *http.Request, p Params) {
+		ps = append(Params(nil), p...)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/1/c/2", nil))
+	tests := map[string]int{"b": 1, "d": 3, "c": -1, "x": -1}
+	for name, want := range tests {
+		if got := ps.IndexOf(name); got != want {
+			t.Errorf("IndexOf(%q): want %d, got %d", name, want, got)
+		}
+	}
+	if ps.ByName("b") != "1" || ps.ByName("d") != "2" || ps.MatchedRoutePath() != "/a/:b/c/:d" {
+		t.Errorf("wrong params: %v", ps)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/x/y", nil))
+	if got := ps.IndexOf("filepath"); got != 1 {
+		t.Errorf("IndexOf(filepath): want 1, got %d", got)
+	}
+
+	// without matched route path
+	if got := (Params{{"b", "1"}}).IndexOf("b"); got != -1 {
+		t.Errorf("IndexOf without matched route path: want -1, got %d", got)
+	}
+}
+
+func TestRouterMiddlewareMatchedRoutePath(t *testing.T) {
+	var mwRoute, handleRoute string
+	auth := func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			mwRoute = ps.MatchedRoutePath()
+			if !strings.HasPrefix(mwRoute, "/admin") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next(w, r, ps)
+		}
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.Use(auth)
+	router.GET("/admin/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		handleRoute = ps.MatchedRoutePath()
+		if id := ps.ByName("id"); id != "7" {
+			t.Errorf("wrong id param: %q", id)
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/7", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	if mwRoute != "/admin/:id" {
+		t.Errorf("wrong matched route in middleware: %q", mwRoute)
+	}
+	if handleRoute != "/admin/:id" {
+		t.Errorf("wrong matched route in handle: %q", handleRoute)
+	}
+
+	// the matched route path must only be added once
+	var routed bool
+	router.GET("/admin", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = true
+		if len(ps) != 1 {
+			t.Errorf("wrong params: %v", ps)
+		}
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if !routed || mwRoute != "/admin" {
+		t.Errorf("wrong result for /admin: routed=%t, matched route %q", routed, mwRoute)
+	}
+}
+
+func TestRouterSkipCanceledRequests(t *testing.T) {
+	var routed, mwRan bool
+	router := New()
+	router.SkipCanceledRequests = true
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			mwRan = true
+			next(w, r, ps)
+		}
+	})
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/user/gopher", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if routed || mwRan {
+		t.Error("handle or middleware called for canceled request")
+	}
+	if w.Body.Len() > 0 || len(w.Header()) > 0 {
+		t.Errorf("response written for canceled request: %v %q", w.Header(), w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed {
+		t.Error("handle not called for live request")
+	}
+}
+
+func TestWrapHandle(t *testing.T) {
+	var got Params
+	var routed bool
+	myHandle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = true
+		got = ps
+	}
+
+	router := New()
+	router.HandlerFunc(http.MethodGet, "/user/:name", WrapHandle(myHandle))
+
+	r := httptest.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed {
+		t.Fatal("routing failed")
+	}
+	if want := (Params{{"name", "gopher"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong params: want %v, got %v", want, got)
+	}
+
+	// without params in the context
+	routed, got = false, Params{}
+	WrapHandle(myHandle).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !routed || got != nil {
+		t.Errorf("wrong params without context: routed=%t, params %v", routed, got)
+	}
+}
+
+func TestRouterDrain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := New()
+	router.GET("/slow", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		close(started)
+		<-release
+	})
+
+	if n := router.InFlight(); n != 0 {
+		t.Errorf("want 0 requests in flight, got %d", n)
+	}
+	if err := router.Drain(context.Background()); err != nil {
+		t.Errorf("drain without requests failed: %v", err)
+	}
+
+	served := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(served)
+	}()
+	<-started
+	if n := router.InFlight(); n != 1 {
+		t.Errorf("want 1 request in flight, got %d", n)
+	}
+
+	// the context expires while the request is still served
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := router.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+
+	drained := make(chan error)
+	go func() {
+		drained <- router.Drain(context.Background())
+	}()
+	select {
+	case <-drained:
+		t.Fatal("drain returned while the request was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-drained; err != nil {
+		t.Errorf("drain failed: %v", err)
+	}
+	<-served
+	if n := router.InFlight(); n != 0 {
+		t.Errorf("want 0 requests in flight after drain, got %d", n)
+	}
+}
+
+func TestRouterSwap(t *testing.T) {
+	table := func(version string) *Router {
+		router := New()
+		router.GET("/version", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte(version))
+		})
+		return router
+	}
+
+	router := table("v0")
+	serve := func() string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("request dropped: status %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// serve concurrently while swapping, run with -race
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if v := serve(); !strings.HasPrefix(v, "v") {
+						t.Errorf("unexpected response %q", v)
+					}
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 50; i++ {
+		router.Swap(table(fmt.Sprintf("v%d", i)))
+	}
+	close(done)
+	wg.Wait()
+
+	if v := serve(); v != "v50" {
+		t.Errorf("want v50 after swaps, got %q", v)
+	}
+
+	// swapping in the router itself restores its own table
+	router.Swap(router)
+	if v := serve(); v != "v0" {
+		t.Errorf("want v0 after restoring, got %q", v)
+	}
+}
+
+func TestRouterUseFirst(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				trace = append(trace, name)
+				next(w, r, ps)
+			}
+		}
+	}
+
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		trace = append(trace, "handle")
+	})
+	router.Use(mw("a"))
+	router.UseFirst(mw("b"), mw("c"))
+	router.UseFirst(mw("d"))
+	router.UseFor(http.MethodGet, mw("get"))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil))
+	if want := []string{"d", "b", "c", "a", "get", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware order: want %v, got %v", want, trace)
+	}
+}
+
+func TestRouterClearMiddleware(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				trace = append(trace, name)
+				next(w, r, ps)
+			}
+		}
+	}
+
+	router := New()
+	router.GET("/admin/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		trace = append(trace, "handle")
+	})
+	if n := router.MiddlewareCount(); n != 0 {
+		t.Errorf("want 0 middleware, got %d", n)
+	}
+	router.Use(mw("global"))
+	router.UseFor(http.MethodGet, mw("get"))
+	router.UsePrefix("/admin", mw("admin"))
+	if n := router.MiddlewareCount(); n != 3 {
+		t.Errorf("want 3 middleware, got %d", n)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/path", nil))
+	if want := []string{"global", "get", "admin", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware before clearing: want %v, got %v", want, trace)
+	}
+
+	router.ClearMiddleware()
+	if n := router.MiddlewareCount(); n != 0 {
+		t.Errorf("want 0 middleware after clearing, got %d", n)
+	}
+	trace = nil
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/path", nil))
+	if want := []string{"handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("middleware ran after clearing: %v", trace)
+	}
+}
+
+func TestRouterClearMiddlewareInFlight(t *testing.T) {
+	var ran int32
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			atomic.AddInt32(&ran, 1)
+			next(w, r, ps)
+		}
+	})
+
+	// serve concurrently while clearing and adding middleware, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil))
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		router.ClearMiddleware()
+		router.Use(func(next Handle) Handle { return next })
+	}
+	wg.Wait()
+}
+
+func TestRouterUsePrefix(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				trace = append(trace, name)
+				next(w, r, ps)
+			}
+		}
+	}
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		trace = append(trace, "handle")
+	}
+
+	router := New()
+	router.GET("/admin/users", handle)
+	router.GET("/admin", handle)
+	router.GET("/administrator", handle)
+	router.GET("/public", handle)
+
+	// added after the routes, in mixed order
+	router.UsePrefix("/admin/users", mw("users"))
+	router.UsePrefix("/admin", mw("auth"), mw("audit"))
+	router.Use(mw("global"))
+
+	tests := []struct {
+		path  string
+		trace []string
+	}{
+		{"/admin/users", []string{"global", "auth", "audit", "users", "handle"}},
+		{"/admin", []string{"global", "auth", "audit", "handle"}},
+		{"/administrator", []string{"global", "handle"}},
+		{"/public", []string{"global", "handle"}},
+	}
+	for _, test := range tests {
+		trace = nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+		if !reflect.DeepEqual(trace, test.trace) {
+			t.Errorf("%s: want %v, got %v", test.path, test.trace, trace)
+		}
+	}
+}
+
+func TestRouterHasRoute(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/a/:b", handlerFunc)
+	router.POST("/static", handlerFunc)
+	router.OPTIONS("*", handlerFunc)
+	router.GET("/orders/:id{max=36}", handlerFunc)
+	router.GET("/points/:pt[2]", handlerFunc)
+	router.GET("/list/:page=1", handlerFunc)
+
+	tests := []struct {
+		method string
+		path   string
+		has    bool
+	}{
+		{http.MethodGet, "/a/:b", true},
+		{http.MethodPost, "/static", true},
+		{http.MethodOptions, "*", true},
+		{http.MethodGet, "/a/:c", false},
+		{http.MethodGet, "/a/x", false},
+		{http.MethodPost, "/a/:b", false},
+		{http.MethodGet, "/static", false},
+		{http.MethodGet, "*", false},
+		{http.MethodGet, "/orders/:id{max=36}", true},
+		{http.MethodGet, "/orders/:id", true},
+		{http.MethodGet, "/points/:pt[2]", true},
+		{http.MethodGet, "/list/:page=1", true},
+		{http.MethodGet, "/list/:page", true},
+		{http.MethodGet, "/list", true},
+	}
+	for _, test := range tests {
+		if has := router.HasRoute(test.method, test.path); has != test.has {
+			t.Errorf("HasRoute(%s, %s): want %t, got %t", test.method, test.path, test.has, has)
+		}
+	}
+}
+
+func TestRouterDisable(t *testing.T) {
+	router := New()
+	router.DisabledRetryAfter = 90 * time.Second
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/gopher", nil))
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("want status 200, got %d", w.Code)
+	}
+
+	if !router.Disable(http.MethodGet, "/user/:name") {
+		t.Fatal("Disable did not find the route")
+	}
+	w := serve()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want status 503 for disabled route, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("wrong Retry-After header: %q", got)
+	}
+
+	if !router.Enable(http.MethodGet, "/user/:name") {
+		t.Fatal("Enable did not find the route")
+	}
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("want status 200 after enabling, got %d", w.Code)
+	}
+
+	if router.Disable(http.MethodGet, "/user/:id") || router.Enable(http.MethodPost, "/user/:name") {
+		t.Error("unregistered route reported as found")
+	}
+}
+
+func TestRouterDisableLimited(t *testing.T) {
+	router := New()
+	router.GET("/orders/:id{max=4}", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/1234", nil))
+		return w.Code
+	}
+
+	if !router.Disable(http.MethodGet, "/orders/:id{max=4}") {
+		t.Fatal("Disable did not find the route")
+	}
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("want status 503 for disabled route, got %d", code)
+	}
+	if !router.Enable(http.MethodGet, "/orders/:id{max=4}") {
+		t.Fatal("Enable did not find the route")
+	}
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("want status 200 after enabling, got %d", code)
+	}
+}
+
+func TestRouterDefaultHeaders(t *testing.T) {
+	router := New()
+	router.DefaultHeaders = http.Header{
+		"X-Content-Type-Options": {"nosniff"},
+		"X-Frame-Options":        {"DENY"},
+	}
+	router.GET("/page", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops")
+	})
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		path         string
+		code         int
+		frameOptions string
+	}{
+		{"/page", http.StatusOK, "SAMEORIGIN"},
+		{"/missing", http.StatusNotFound, "DENY"},
+		{"/panic", http.StatusInternalServerError, "DENY"},
+		{"/page/", http.StatusMovedPermanently, "DENY"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: want status %d, got %d", test.path, test.code, w.Code)
+		}
+		if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: wrong X-Content-Type-Options header: %q", test.path, got)
+		}
+		if got := w.Header().Get("X-Frame-Options"); got != test.frameOptions {
+			t.Errorf("%s: wrong X-Frame-Options header: want %q, got %q", test.path, test.frameOptions, got)
+		}
+	}
+
+	// the default headers must not be modified through responses
+	if got := router.DefaultHeaders.Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("default headers were modified: %q", got)
+	}
+}
+
+func TestRouterRepanicAfterHandler(t *testing.T) {
+	for _, usePanicHandler2 := range []bool{false, true} {
+		var handled int
+		router := New()
+		router.RepanicAfterHandler = true
+		if usePanicHandler2 {
+			router.PanicHandler2 = func(w http.ResponseWriter, _ *http.Request, _ PanicInfo) {
+				handled++
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		} else {
+			router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+				handled++
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+		router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			panic("oops")
+		})
+
+		w := httptest.NewRecorder()
+		recv := catchPanic(func() {
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		})
+		if recv != "oops" {
+			t.Errorf("PanicHandler2=%t: panic did not propagate with the original value: %v", usePanicHandler2, recv)
+		}
+		if handled != 1 {
+			t.Errorf("PanicHandler2=%t: handler called %d times", usePanicHandler2, handled)
+		}
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("PanicHandler2=%t: wrong status code: %d", usePanicHandler2, w.Code)
+		}
+	}
+}
+
+func TestRouterServeFile(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"static/favicon.ico": &fstest.MapFile{
+			Data:    []byte("\x00\x00\x01\x00icon"),
+			ModTime: modTime,
+		},
+	}
+
+	router := New()
+	router.ServeFile("/favicon.ico", http.FS(fsys), "static/favicon.ico")
+	router.ServeFile("/robots.txt", http.FS(fsys), "static/robots.txt")
+
+	r := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("serving file failed: Code=%d", w.Code)
+	}
+	if body := w.Body.String(); body != "\x00\x00\x01\x00icon" {
+		t.Errorf("wrong body: %q", body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct == "" {
+		t.Error("no Content-Type set")
+	}
+
+	// HEAD
+	r = httptest.NewRequest(http.MethodHead, "/favicon.ico", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	// conditional request
+	r = httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	r.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional request failed: Code=%d", w.Code)
+	}
+
+	// missing file
+	r = httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing file not handled: Code=%d", w.Code)
+	}
+}
+
+func TestRouterJSONErrors(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.SetNotFoundJSON(`{"error":"not found"}`)
+	router.SetMethodNotAllowedJSON(`{"error":"method not allowed"}`)
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/nope", http.StatusNotFound, `{"error":"not found"}`},
+		{http.MethodGet, "/path", http.StatusMethodNotAllowed, `{"error":"method not allowed"}`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: wrong status code: want %d, got %d", test.method, test.route, test.code, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: wrong Content-Type: %q", test.method, test.route, ct)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s %s: wrong body: want %q, got %q", test.method, test.route, test.body, body)
+		}
+	}
+}
+
+func TestRouterSetNotFound(t *testing.T) {
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.SetNotFoundJSON(`{"error":"not found"}`)
+	router.SetNotFound(http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>Not Found</h1>"))
+	}))
+
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+	}{
+		{http.MethodGet, "text/html; charset=utf-8", "<h1>Not Found</h1>"},
+		{http.MethodPost, "application/json", `{"error":"not found"}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, "/nope", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: want status 404, got %d", test.method, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%s: wrong Content-Type: want %q, got %q", test.method, test.contentType, ct)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s: wrong body: want %q, got %q", test.method, test.body, body)
+		}
+	}
+
+	// removing the GET handler falls back to NotFound
+	router.SetNotFound(http.MethodGet, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if body := w.Body.String(); body != `{"error":"not found"}` {
+		t.Errorf("removed GET handler: wrong body: %q", body)
+	}
+}
+
+func TestRouterAttemptedPath(t *testing.T) {
+	var attempted string
+	router := New()
+	router.GET("/y", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted = AttemptedPathFromContext(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	tests := []struct {
+		route     string
+		attempted string
+	}{
+		{"/../x", "/x"},
+		{"/a/./b//c/", "/a/b/c/"},
+		{"/x", "/x"},
+	}
+	for _, test := range tests {
+		attempted = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: want status 404, got %d", test.route, w.Code)
+		}
+		if attempted != test.attempted {
+			t.Errorf("%s: want attempted path %q, got %q", test.route, test.attempted, attempted)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/y", nil)
+	if path := AttemptedPathFromContext(r.Context()); path != "" {
+		t.Errorf("unexpected attempted path %q", path)
+	}
+}
+
+func TestRouterDefaultHandler(t *testing.T) {
+	var routed, attempted string
+	var status MatchStatus
+	var hasStatus bool
+	router := New()
+	router.GET("/local", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "local"
+	})
+	router.POST("/form", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "form"
+	})
+	router.DefaultHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed = "default"
+		status, hasStatus = MatchStatusFromContext(r.Context())
+		attempted = AttemptedPathFromContext(r.Context())
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	tests := []struct {
+		method    string
+		route     string
+		routed    string
+		status    MatchStatus
+		attempted string
+	}{
+		{http.MethodGet, "/local", "local", 0, ""},
+		{http.MethodPost, "/form", "form", 0, ""},
+		{http.MethodGet, "/remote/x", "default", MatchNone, "/remote/x"},
+		{http.MethodGet, "/remote/../y", "default", MatchNone, "/y"},
+		{http.MethodGet, "/form", "default", MatchOtherMethod, "/form"},
+		{http.MethodGet, "/local/", "default", MatchTrailingSlash, "/local/"},
+		{http.MethodPut, "/remote", "default", MatchNone, "/remote"},
+	}
+	for _, test := range tests {
+		routed, attempted, status, hasStatus = "", "", 0, false
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.route, nil))
+		if routed != test.routed {
+			t.Errorf("%s %s: want %q, got %q", test.method, test.route, test.routed, routed)
+		}
+		if test.routed != "default" {
+			continue
+		}
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s %s: want status 502, got %d", test.method, test.route, w.Code)
+		}
+		if !hasStatus || status != test.status {
+			t.Errorf("%s %s: want match status %d, got %d (%v)", test.method, test.route, test.status, status, hasStatus)
+		}
+		if attempted != test.attempted {
+			t.Errorf("%s %s: want attempted path %q, got %q", test.method, test.route, test.attempted, attempted)
+		}
+	}
+}
+
+func TestRouterChainingParams(t *testing.T) {
+	var tenant, rest string
+	handlerFunc := func(_ http.ResponseWriter, r *http.Request) {
+		ps := ParamsFromContext(r.Context())
+		tenant = ps.ByName("t")
+		rest = ps.ByName("path")
+	}
+
+	// delegation from a matched catch-all route
+	inner := New()
+	inner.HandlerFunc(http.MethodGet, "/tenant/*path", handlerFunc)
+	outer := New()
+	outer.Handler(http.MethodGet, "/tenant/:t/*rest", inner)
+
+	r := httptest.NewRequest(http.MethodGet, "/tenant/acme/users", nil)
+	outer.ServeHTTP(httptest.NewRecorder(), r)
+	if tenant != "acme" || rest != "/acme/users" {
+		t.Errorf("params not inherited: t=%q, path=%q", tenant, rest)
+	}
+
+	// delegation via NotFound
+	tenant, rest = "", ""
+	outer = New()
+	outer.GET("/tenant/:t/settings", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	outer.NotFound = inner
+
+	r = httptest.NewRequest(http.MethodGet, "/tenant/acme/users", nil)
+	outer.ServeHTTP(httptest.NewRecorder(), r)
+	if tenant != "acme" || rest != "/acme/users" {
+		t.Errorf("params not inherited via NotFound: t=%q, path=%q", tenant, rest)
+	}
+
+	// the inner handle receives its own params first
+	var got Params
+	inner = New()
+	inner.GET("/tenant/:t/users/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = ps
+	})
+	outer = New()
+	outer.Handler(http.MethodGet, "/tenant/:tenant/*rest", inner)
+
+	r = httptest.NewRequest(http.MethodGet, "/tenant/acme/users/1", nil)
+	outer.ServeHTTP(httptest.NewRecorder(), r)
+	want := Params{
+		{"t", "acme"},
+		{"id", "1"},
+		{"tenant", "acme"},
+		{"rest", "/users/1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong params: want %v, got %v", want, got)
+	}
+
+	// the path of the route matched by the outer router is not inherited
+	got = nil
+	inner = New()
+	inner.SaveMatchedRoutePath = true
+	inner.GET("/x/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = append(Params(nil), ps...)
+	})
+	outer = New()
+	outer.SaveMatchedRoutePath = true
+	outer.Handler(http.MethodGet, "/x/*rest", inner)
+
+	r = httptest.NewRequest(http.MethodGet, "/x/5", nil)
+	outer.ServeHTTP(httptest.NewRecorder(), r)
+	want = Params{
+		{"id", "5"},
+		{MatchedRoutePathParam, "/x/:id"},
+		{"rest", "/5"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong params: want %v, got %v", want, got)
+	}
+	if got.MatchedRoutePath() != "/x/:id" || got[0].Value != "5" {
+		t.Errorf("wrong matched route path %q or first param %v", got.MatchedRoutePath(), got[0])
+	}
+}
+
+func TestRouterPermanentRedirects(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.PUT("/path", handlerFunc)
+
+	tests := []struct {
+		permanent bool
+		method    string
+		route     string
+		code      int
+	}{
+		{true, http.MethodGet, "/path/", http.StatusMovedPermanently},
+		{true, http.MethodPut, "/path/", http.StatusPermanentRedirect},
+		{true, http.MethodGet, "/PATH", http.StatusMovedPermanently},
+		{true, http.MethodPut, "/PATH", http.StatusPermanentRedirect},
+		{false, http.MethodGet, "/path/", http.StatusFound},
+		{false, http.MethodPut, "/path/", http.StatusTemporaryRedirect},
+		{false, http.MethodGet, "/PATH", http.StatusFound},
+		{false, http.MethodPut, "/PATH", http.StatusTemporaryRedirect},
+	}
+	for _, test := range tests {
+		router.PermanentRedirects = test.permanent
+		r := httptest.NewRequest(test.method, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("%s %s (permanent=%t): want %d, got Code=%d, Location=%q",
+				test.method, test.route, test.permanent, test.code, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterHandleStd(t *testing.T) {
+	var name string
+	router := New()
+	router.HandleStd(http.MethodGet, "/user/:name", func(_ http.ResponseWriter, r *http.Request) {
+		name = ParamsFromContext(r.Context()).ByName("name")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if name != "gopher" {
+		t.Errorf("wrong param value: want %q, got %q", "gopher", name)
+	}
+}
+
+func TestRouterGate(t *testing.T) {
+	var patterns []string
+	router := New()
+	router.GET("/expensive/:id", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		t.Error("handle of gated route called")
+	})
+	router.GET("/cheap/:id", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Gate = func(w http.ResponseWriter, r *http.Request, pattern string) bool {
+		patterns = append(patterns, pattern)
+		if pattern == "/expensive/:id" {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return false
+		}
+		return true
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/expensive/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("gated route not blocked: Code=%d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/cheap/1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("allowed route blocked: Code=%d", w.Code)
+	}
+
+	// no gate for unmatched requests
+	r = httptest.NewRequest(http.MethodGet, "/nope", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := []string{"/expensive/:id", "/cheap/:id"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("wrong patterns passed to gate: want %v, got %v", want, patterns)
+	}
+}
+
+func TestRouterHandleErr(t *testing.T) {
+	errInvalid := errors.New("invalid input")
+
+	router := New()
+	router.HandleErr(http.MethodPost, "/items/:id", func(w http.ResponseWriter, _ *http.Request, ps Params) error {
+		switch ps.ByName("id") {
+		case "invalid":
+			return errInvalid
+		case "broken":
+			return errors.New("something broke")
+		}
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	})
+
+	tests := []struct {
+		route string
+		code  int
+	}{
+		{"/items/1", http.StatusCreated},
+		{"/items/broken", http.StatusInternalServerError}, // default responder
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: wrong status code: want %d, got %d", test.route, test.code, w.Code)
+		}
+	}
+
+	router.ErrorResponder = func(w http.ResponseWriter, _ *http.Request, err error) {
+		if errors.Is(err, errInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	tests = []struct {
+		route string
+		code  int
+	}{
+		{"/items/1", http.StatusCreated},
+		{"/items/invalid", http.StatusBadRequest},
+		{"/items/broken", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: wrong status code: want %d, got %d", test.route, test.code, w.Code)
+		}
+	}
+}
+
+func TestRouterDecodePlusAsSpace(t *testing.T) {
+	var value string
+	router := New()
+	router.GET("/q/:query", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		value = ps.ByName("query")
+	})
+
+	tests := []struct {
+		plusAsSpace bool
+		route       string
+		value       string
+	}{
+		{false, "/q/a+b", "a+b"},
+		{false, "/q/a%2Bb", "a+b"},
+		{false, "/q/a%20b", "a b"},
+		{true, "/q/a+b", "a b"},
+		{true, "/q/a%2Bb", "a+b"},
+		{true, "/q/a+b%20c", "a b c"},
+	}
+	for _, test := range tests {
+		router.DecodePlusAsSpace = test.plusAsSpace
+		value = ""
+		r := httptest.NewRequest(http.MethodGet, test.route, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if value != test.value {
+			t.Errorf("%s (plusAsSpace=%t): want %q, got %q", test.route, test.plusAsSpace, test.value, value)
+		}
+	}
+}
+
+func TestRouterAny(t *testing.T) {
+	var routed string
+	router := New()
+	router.Any("/proxy/*path", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		routed = "any " + r.Method + " " + ps.ByName("path")
+	})
+	router.GET("/proxy/*path", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		routed = "get " + ps.ByName("path")
+	})
+	router.POST("/other", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	tests := []struct {
+		method string
+		route  string
+		routed string
+	}{
+		{http.MethodGet, "/proxy/a", "get /a"}, // explicit route takes precedence
+		{http.MethodPost, "/proxy/a", "any POST /a"},
+		{http.MethodDelete, "/proxy/a/b", "any DELETE /a/b"},
+		{"PURGE", "/proxy/c", "any PURGE /c"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r := httptest.NewRequest(test.method, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || routed != test.routed {
+			t.Errorf("%s %s: want %q, got Code=%d %q", test.method, test.route, test.routed, w.Code, routed)
+		}
+	}
+
+	// Any routes don't show up as allowed method
+	r := httptest.NewRequest(http.MethodGet, "/other", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("NotAllowed handling failed: Code=%d", w.Code)
+	} else if allow := w.Header().Get("Allow"); allow != "OPTIONS, POST" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+}
+
+func TestRouterOnRouteConflict(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	type conflict struct{ existing, new string }
+	var conflicts []conflict
+
+	router := New()
+	router.OnRouteConflict = func(existing, new string) {
+		conflicts = append(conflicts, conflict{existing, new})
+	}
+	register := func(path string) (panicked bool) {
+		return catchPanic(func() { router.GET(path, handlerFunc) }) != nil
+	}
+
+	tests := []struct {
+		path     string
+		panics   bool
+		existing []string
+	}{
+		{"/users/:id", false, nil},
+		{"/users/:id/posts", false, nil},
+		{"/users/:name", true, []string{"/users/:id", "/users/:id/posts"}}, // param name mismatch
+		{"/users/new", false, []string{"/users/:id"}},                      // static vs param overlap
+		{"/users/new/posts/", false, nil},                                  // no common request
+		{"/files/*filepath", false, nil},
+		{"/files/:name/x", true, []string{"/files/*filepath"}}, // param vs catch-all
+	}
+	for _, test := range tests {
+		conflicts = nil
+		if panicked := register(test.path); panicked != test.panics {
+			t.Errorf("%s: want panic %t, got %t", test.path, test.panics, panicked)
+		}
+		var want []conflict
+		for _, existing := range test.existing {
+			want = append(want, conflict{existing, test.path})
+		}
+		if !reflect.DeepEqual(conflicts, want) {
+			t.Errorf("%s: wrong conflicts reported:\nwant %v\n got %v", test.path, want, conflicts)
+		}
+	}
+
+	// different methods do not conflict
+	conflicts = nil
+	router.POST("/users/:name", handlerFunc)
+	if len(conflicts) > 0 {
+		t.Errorf("conflict reported for a different method: %v", conflicts)
+	}
+
+	// overlapping routes are registered, the static one takes precedence
+	var routed string
+	router.GET("/show/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = "id=" + ps.ByName("id")
+	})
+	router.GET("/show/all", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "all"
+	})
+	for path, want := range map[string]string{"/show/all": "all", "/show/gopher": "id=gopher"} {
+		routed = ""
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if routed != want {
+			t.Errorf("%s: want %q, got %q", path, want, routed)
+		}
+	}
+}
+
+func TestRouterLookupInto(t *testing.T) {
+	var routed bool
+	router := New()
+	router.GET("/user/:name/:page", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+
+	var ps Params
+	handle, tsr := router.LookupInto(http.MethodGet, "/user/gopher/2", &ps)
+	if handle == nil || tsr {
+		t.Fatalf("route not found: tsr=%t", tsr)
+	}
+	handle(nil, nil, ps)
+	if !routed {
+		t.Error("wrong handle returned")
+	}
+	if want := (Params{{"name", "gopher"}, {"page", "2"}}); !reflect.DeepEqual(ps, want) {
+		t.Errorf("wrong params: want %v, got %v", want, ps)
+	}
+
+	handle, tsr = router.LookupInto(http.MethodGet, "/user/gopher/2/", &ps)
+	if handle != nil || !tsr {
+		t.Errorf("want TSR recommendation, got handle %v, tsr=%t", handle, tsr)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		router.LookupInto(http.MethodGet, "/user/gopher/2", &ps)
+	})
+	if allocs > 0 {
+		t.Errorf("LookupInto allocated %v times", allocs)
+	}
+}
+
+func TestRouterLookupLikeServeHTTP(t *testing.T) {
+	var served Params
+	router := New()
+	router.DecodePlusAsSpace = true
+	router.EmptySegmentPolicy = EmptySegmentMatch
+	router.GET("/q/:query/:page", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		served = append(Params{}, ps...)
+	})
+
+	for _, path := range []string{"/q/a+b/1", "/q//1", "/q/a%2Bb/"} {
+		served = nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+
+		handle, ps, _ := router.Lookup(http.MethodGet, path)
+		if (handle != nil) != (served != nil) {
+			t.Errorf("Lookup(%q): want found %t, got %t", path, served != nil, handle != nil)
+		} else if handle != nil && !reflect.DeepEqual(ps, served) {
+			t.Errorf("Lookup(%q): want params %v, got %v", path, served, ps)
+		}
+
+		var into Params
+		handle, _ = router.LookupInto(http.MethodGet, path, &into)
+		if (handle != nil) != (served != nil) {
+			t.Errorf("LookupInto(%q): want found %t, got %t", path, served != nil, handle != nil)
+		} else if handle != nil && !reflect.DeepEqual(into, served) {
+			t.Errorf("LookupInto(%q): want params %v, got %v", path, served, into)
+		}
+	}
+}
+
+func BenchmarkRouterLookup(b *testing.B) {
+	router := New()
+	router.GET("/user/:name/:page", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	b.Run("Lookup", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			router.Lookup(http.MethodGet, "/user/gopher/2")
+		}
+	})
+	b.Run("LookupInto", func(b *testing.B) {
+		var ps Params
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			router.LookupInto(http.MethodGet, "/user/gopher/2", &ps)
+		}
+	})
+}
+
+func TestRouterServeParamsAllocs(t *testing.T) {
+	router := New()
+	router.GET("/user/:name/repos/:repo", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/user/gopher/repos/httprouter?tab=code", nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(w, req)
+	})
+	if allocs > 0 {
+		t.Errorf("serving a route with 2 params allocated %v times", allocs)
+	}
+}
+
+func TestRouterServeMixedAllocs(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/users/new", handle)
+	router.GET("/users/newest/posts", handle)
+	router.GET("/users/:name", handle)
+	router.GET("/users/:name/posts", handle)
+	router.GET("/:lang/home", handle)
+	router.GET("/admin/home", handle)
+
+	w := httptest.NewRecorder()
+	for _, path := range []string{
+		"/users/new",
+		"/users/abc",
+		"/users/newest", // falls back to the param
+		"/users/new/posts",
+		"/en/home",
+		"/admin/home",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			router.ServeHTTP(w, req)
+		})
+		if allocs > 0 {
+			t.Errorf("serving %s below static and param routes allocated %v times", path, allocs)
+		}
+	}
+}
+
+func BenchmarkRouterServeParams(b *testing.B) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	routes := []struct {
+		name   string
+		path   string
+		reqURI string
+	}{
+		{"0", "/user", "/user"},
+		{"2", "/user/:name/repos/:repo", "/user/gopher/repos/httprouter"},
+		{"5", "/:a/:b/:c/:d/:e", "/1/2/3/4/5"},
+	}
+	for _, route := range routes {
+		router := New()
+		router.GET(route.path, handle)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, route.reqURI, nil)
+
+		b.Run(route.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+func TestRouterLookupRequest(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.Any("/any/:name", handlerFunc)
+
+	tests := []struct {
+		method string
+		target string
+		found  bool
+		ps     Params
+		tsr    bool
+	}{
+		{http.MethodGet, "/user/gopher?x=1", true, Params{{"name", "gopher"}}, false},
+		{http.MethodGet, "/user/go%2Fpher", true, Params{{"name", "go/pher"}}, false},
+		{http.MethodGet, "/user/gopher/", false, nil, true},
+		{http.MethodPost, "/user/gopher", false, nil, false},
+		{http.MethodPost, "/any/gopher", true, Params{{"name", "gopher"}}, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		handle, ps, tsr := router.LookupRequest(r)
+		if (handle != nil) != test.found {
+			t.Errorf("%s %s: want found=%t, got handle %v", test.method, test.target, test.found, handle)
+		}
+		if !reflect.DeepEqual(ps, test.ps) {
+			t.Errorf("%s %s: wrong params: want %v, got %v", test.method, test.target, test.ps, ps)
+		}
+		if tsr != test.tsr {
+			t.Errorf("%s %s: wrong TSR recommendation: want %t, got %t", test.method, test.target, test.tsr, tsr)
+		}
+	}
+}
+
+func TestRouterLookupRequestLikeServeHTTP(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.CaseInsensitiveMethods = true
+	router.DecodePlusAsSpace = true
+	router.MaxSegments = 4
+	router.RewritePath = func(path string) string {
+		return strings.TrimPrefix(path, "/v1")
+	}
+	router.GET("/user/:name", handle("user"))
+	router.GET("/files/:name", handle("files"))
+	router.Any("/files/:name", handle("any")).Priority(1)
+	router.PrefixMatch("/static/", handle("static"))
+
+	tests := []struct {
+		method string
+		target string
+		routed string
+		ps     Params
+	}{
+		{"get", "/v1/user/go+pher", "user", Params{{"name", "go pher"}}},
+		{http.MethodGet, "/user/gopher", "user", Params{{"name", "gopher"}}},
+		{http.MethodGet, "/files/a", "any", Params{{"name", "a"}}},
+		{http.MethodGet, "/v1/static/css/a.css", "static", Params{{PrefixRestParam, "css/a.css"}}},
+		{http.MethodGet, "/a/b/c/d/e", "", nil}, // too many segments
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.target, nil)
+		routed = ""
+		handle, ps, _ := router.LookupRequest(r)
+		if handle != nil {
+			handle(httptest.NewRecorder(), r, ps)
+		}
+		if routed != test.routed || !reflect.DeepEqual(ps, test.ps) {
+			t.Errorf("%s %s: want %q %v, got %q %v", test.method, test.target, test.routed, test.ps, routed, ps)
+		}
+		if r.Method != test.method || r.URL.Path != strings.SplitN(test.target, "?", 2)[0] {
+			t.Errorf("%s %s: request modified to %s %s", test.method, test.target, r.Method, r.URL.Path)
+		}
+
+		// ServeHTTP resolves the same route
+		routed = ""
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != test.routed {
+			t.Errorf("%s %s: ServeHTTP routed to %q, LookupRequest to %q", test.method, test.target, routed, test.routed)
+		}
+	}
+}
+
+func TestRouterDumpTree(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/users", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	want := `"/" <root> [handle /]
+  "user" <static>
+    "/" <static>
+      ":name" <param> [handle /user/:name]
+    "s" <static> [handle /users]
+  "src" <static>
+    "" <catchAll>
+      "/*filepath" <catchAll> [handle /src/*filepath]
+`
+	if got := router.DumpTree(http.MethodGet); got != want {
+		t.Errorf("wrong tree dump:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+	if got := router.DumpTree(http.MethodPost); got != "" {
+		t.Errorf("expected empty dump for unused method, got:\n%s", got)
+	}
+}
+
+func TestRouterRegister(t *testing.T) {
+	var routed bool
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}
+
+	router := New()
+	err := router.Register([]RouteDef{
+		{http.MethodGet, "/valid/:id", handlerFunc},
+		{http.MethodGet, "invalid", handlerFunc},
+		{http.MethodGet, "/valid/:name", handlerFunc},
+	})
+
+	errs, ok := err.(RouteErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 route errors, got %v", err)
+	}
+	if errs[0].Path != "invalid" || errs[1].Path != "/valid/:name" {
+		t.Errorf("wrong routes reported: %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "GET invalid") || !strings.Contains(msg, "GET /valid/:name") {
+		t.Errorf("error does not name the invalid routes: %s", msg)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/valid/1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed {
+		t.Error("valid route was not registered")
+	}
+
+	if err := router.Register([]RouteDef{{http.MethodPost, "/valid", handlerFunc}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRouterCaseInsensitiveMethods(t *testing.T) {
+	var routed string
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		routed = r.Method
+	})
+
+	for _, enabled := range []bool{false, true} {
+		router.CaseInsensitiveMethods = enabled
+		for _, method := range []string{"get", "Get", "GET"} {
+			code, want := http.StatusMethodNotAllowed, ""
+			if enabled || method == http.MethodGet {
+				code, want = http.StatusOK, http.MethodGet
+			}
+
+			routed = ""
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, "/path", nil))
+			if w.Code != code {
+				t.Errorf("%s (enabled=%v): want status %d, got %d", method, enabled, code, w.Code)
+			}
+			if routed != want {
+				t.Errorf("%s (enabled=%v): want handle to see method %q, got %q", method, enabled, want, routed)
+			}
+		}
+	}
+
+	// unknown paths still 404
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("get", "/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status 404, got %d", w.Code)
+	}
+}
+
+func TestRouterUnknownMethodHandler(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/coffee", handlerFunc)
+	router.Handle("PROPFIND", "/dav", handlerFunc)
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+	}{
+		{"BREW", "/coffee", http.StatusNotImplemented},
+		{"BREW", "/tea", http.StatusNotImplemented},
+		{"PROPFIND", "/dav", http.StatusOK},
+		{"PROPFIND", "/coffee", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/coffee", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/tea", http.StatusNotFound},
+	}
+
+	// without the handler, unknown methods are answered like any other
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("BREW", "/coffee", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler not set: want status 405, got %d", w.Code)
+	}
+
+	router.UnknownMethodHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	})
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.route, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s: want status %d, got %d", test.method, test.route, test.code, w.Code)
+		}
+	}
+}
+
+func TestRouterHandleIf(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	if route := router.HandleIf(false, http.MethodGet, "/beta", handlerFunc); route != nil {
+		t.Error("HandleIf returned a route for a false condition")
+	}
+	if router.HasRoute(http.MethodGet, "/beta") {
+		t.Error("route registered for a false condition")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/beta", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want status 404, got %d", w.Code)
+	}
+
+	if route := router.HandleIf(true, http.MethodGet, "/stable", handlerFunc); route == nil {
+		t.Error("HandleIf returned no route for a true condition")
+	}
+	if !router.HasRoute(http.MethodGet, "/stable") {
+		t.Error("route not registered for a true condition")
+	}
+}
+
+func TestRouterAlias(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.GET("/about", handle("about"))
+	router.POST("/about", handle("about-post"))
+	router.Alias("/about-us", "/about")
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+		routed string
+	}{
+		{http.MethodGet, "/about", http.StatusOK, "about"},
+		{http.MethodGet, "/about-us", http.StatusOK, "about"},
+		{http.MethodPost, "/about-us", http.StatusOK, "about-post"},
+		{http.MethodPut, "/about-us", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/about-us/", http.StatusMovedPermanently, ""},
+		{http.MethodGet, "/ABOUT-US", http.StatusMovedPermanently, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.route, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s: want status %d, got %d", test.method, test.route, test.code, w.Code)
+		}
+		if routed != test.routed {
+			t.Errorf("%s %s: want %q, got %q", test.method, test.route, test.routed, routed)
+		}
+	}
+
+	// changes of the target route apply to the alias
+	router.Disable(http.MethodGet, "/about")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about-us", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("alias of a disabled route: want status 503, got %d", w.Code)
+	}
+	router.Enable(http.MethodGet, "/about")
+	routed = ""
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/about-us", nil))
+	if routed != "about" {
+		t.Errorf("alias of a re-enabled route: want %q, got %q", "about", routed)
+	}
+
+	if recv := catchPanic(func() { router.Alias("/team", "/people") }); recv == nil {
+		t.Error("no panic for alias of an unregistered path")
+	}
+
+	// the params of the alias must be those of the target
+	var id string
+	router.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		id = ps.ByName("id")
+	})
+	router.Alias("/u/:id{max=8}", "/users/:id")
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/u/42", nil))
+	if id != "42" {
+		t.Errorf("alias with params: want id %q, got %q", "42", id)
+	}
+	for _, alias := range []string{"/u/:uid", "/u/:id/:x", "/u", "/u/*id"} {
+		if recv := catchPanic(func() { router.Alias(alias, "/users/:id") }); recv == nil {
+			t.Errorf("no panic for alias %s with params differing from /users/:id", alias)
+		}
+	}
+}
+
+func TestRouterExact(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.Exact(http.MethodGet, "/metrics", handle("metrics"))
+	router.Exact(http.MethodGet, "/debug/", handle("debug"))
+	router.GET("/users", handle("users"))
+
+	tests := []struct {
+		route  string
+		code   int
+		routed string
+	}{
+		{"/metrics", http.StatusOK, "metrics"},
+		{"/metrics/", http.StatusNotFound, ""},
+		{"/METRICS", http.StatusNotFound, ""},
+		{"/../metrics", http.StatusNotFound, ""},
+		{"/debug/", http.StatusOK, "debug"},
+		{"/debug", http.StatusNotFound, ""},
+		{"/users/", http.StatusMovedPermanently, ""},
+		{"/USERS", http.StatusMovedPermanently, ""},
+	}
+	for _, tolerate := range []bool{false, true} {
+		router.TolerateTrailingSlash = tolerate
+		for _, test := range tests {
+			code := test.code
+			if tolerate && test.route == "/users/" {
+				code = http.StatusOK
+			}
+			routed = ""
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.route, nil))
+			if w.Code != code {
+				t.Errorf("%s (tolerate=%v): want status %d, got %d", test.route, tolerate, code, w.Code)
+			}
+			if code != http.StatusOK && routed != "" {
+				t.Errorf("%s (tolerate=%v): served by %q", test.route, tolerate, routed)
+			}
+		}
+	}
+
+	// no redirect for other methods either
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("POST /metrics/: want status 404, got %d", w.Code)
+	}
+}
+
+func TestRouterBlankSegment(t *testing.T) {
+	var got Params
+	var routed bool
+	router := New()
+	router.ResolveCacheSize = 8
+	router.GET("/a/_/c", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed, got = true, ps
+	})
+	router.GET("/api/_/users/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed, got = true, append(Params(nil), ps...)
+	})
+
+	tests := []struct {
+		route  string
+		routed bool
+		ps     Params
+	}{
+		{"/a/x/c", true, nil},
+		{"/a/y/c", true, nil},
+		{"/a/c", false, nil},
+		{"/a/x/y/c", false, nil},
+		{"/api/v1/users/42", true, Params{{"id", "42"}}},
+		{"/api/v2/users/7", true, Params{{"id", "7"}}},
+		{"/api/users/42", false, nil},
+	}
+	// twice, to serve from the cache the second time
+	for i := 0; i < 2; i++ {
+		for _, test := range tests {
+			routed, got = false, nil
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.route, nil))
+			if routed != test.routed {
+				t.Errorf("%s: want routed %v, got %v", test.route, test.routed, routed)
+			}
+			if !reflect.DeepEqual(got, test.ps) {
+				t.Errorf("%s: wrong params: want %v, got %v", test.route, test.ps, got)
+			}
+		}
+	}
+
+	if !router.HasRoute(http.MethodGet, "/a/_/c") {
+		t.Error("HasRoute does not find the route with a blank segment")
+	}
+}
+
+func TestRouterMaxRoutes(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.MaxRoutes = 3
+	router.GET("/a", handlerFunc)
+	router.POST("/a", handlerFunc)
+	if _, err := router.TryHandle(http.MethodGet, "/b/:id", handlerFunc); err != nil {
+		t.Fatalf("route within the limit failed: %v", err)
+	}
+
+	route, err := router.TryHandle(http.MethodGet, "/c", handlerFunc)
+	if route != nil || !errors.Is(err, ErrTooManyRoutes) {
+		t.Errorf("want ErrTooManyRoutes, got %v", err)
+	}
+	if recv := catchPanic(func() { router.PUT("/d", handlerFunc) }); recv != ErrTooManyRoutes {
+		t.Errorf("want panic with ErrTooManyRoutes, got %v", recv)
+	}
+
+	// the rejected routes were not registered
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/c", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("rejected route was registered: status %d", w.Code)
+	}
+
+	// invalid routes do not count
+	router = New()
+	router.MaxRoutes = 1
+	if _, err := router.TryHandle(http.MethodGet, "invalid", handlerFunc); err == nil {
+		t.Error("invalid route was registered")
+	}
+	if _, err := router.TryHandle(http.MethodGet, "/valid", handlerFunc); err != nil {
+		t.Errorf("route within the limit failed after an invalid one: %v", err)
+	}
+}
+
+func TestRouterFreeze(t *testing.T) {
+	routed := false
+	router := New()
+	router.GET("/a", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+	router.Freeze()
+
+	if recv := catchPanic(func() { router.GET("/b", nil) }); recv != ErrFrozen {
+		t.Errorf("want panic with ErrFrozen, got %v", recv)
+	}
+	if recv := catchPanic(func() { router.Alias("/c", "/a") }); recv != ErrFrozen {
+		t.Errorf("alias: want panic with ErrFrozen, got %v", recv)
+	}
+	if _, err := router.TryHandle(http.MethodGet, "/d", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}); !errors.Is(err, ErrFrozen) {
+		t.Errorf("want ErrFrozen, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a", nil))
+	if w.Code != http.StatusOK || !routed {
+		t.Errorf("frozen router did not serve the route: status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/b", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("route registered after Freeze: status %d", w.Code)
+	}
+}
+
+func TestRouterPanicHandler2(t *testing.T) {
+	var info PanicInfo
+	router := New()
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {
+		t.Error("PanicHandler called although PanicHandler2 is set")
+	}
+	router.PanicHandler2 = func(w http.ResponseWriter, _ *http.Request, pi PanicInfo) {
+		info = pi
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.PUT("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	r := httptest.NewRequest(http.MethodPut, "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status code: %d", w.Code)
+	}
+	if info.Value != "oops!" || info.Pattern != "/user/:name" {
+		t.Errorf("wrong panic info: %+v", info)
+	}
+
+	// panics outside of a route have no pattern
+	info = PanicInfo{}
+	router.NotFound = http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("not found")
+	})
+	r = httptest.NewRequest(http.MethodGet, "/nope", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if info.Value != "not found" || info.Pattern != "" {
+		t.Errorf("wrong panic info: %+v", info)
+	}
+}
+
+func TestRouterBraceSyntax(t *testing.T) {
+	var colonParams, braceParams Params
+	colon := New()
+	colon.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		colonParams = ps
+	})
+	colon.GET("/files/*filepath", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		colonParams = ps
+	})
+
+	brace := New()
+	brace.BraceSyntax = true
+	brace.GET("/user/{name}", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		braceParams = ps
+	})
+	brace.GET("/files/{filepath...}", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		braceParams = ps
+	})
+
+	for _, route := range []string{"/user/gopher", "/files/", "/files/a/b.txt", "/user/gopher/", "/nope"} {
+		colonParams, braceParams = nil, nil
+		wColon, wBrace := httptest.NewRecorder(), httptest.NewRecorder()
+		colon.ServeHTTP(wColon, httptest.NewRequest(http.MethodGet, route, nil))
+		brace.ServeHTTP(wBrace, httptest.NewRequest(http.MethodGet, route, nil))
+		if wColon.Code != wBrace.Code {
+			t.Errorf("%s: different status codes: colon=%d, brace=%d", route, wColon.Code, wBrace.Code)
+		}
+		if !reflect.DeepEqual(colonParams, braceParams) {
+			t.Errorf("%s: different params: colon=%v, brace=%v", route, colonParams, braceParams)
+		}
+	}
+
+	recv := catchPanic(func() {
+		brace.GET("/broken/{name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	})
+	if recv == nil {
+		t.Error("registering path with unclosed brace did not panic")
+	}
+}
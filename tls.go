@@ -0,0 +1,85 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequireTLS returns middleware which only passes on requests received over
+// TLS, see Router.Use. Other requests are redirected to the same URL with the
+// https scheme with status code 308 if redirect is set, which keeps the method
+// and body, and answered with status code 403 otherwise.
+// The port of the Host header is dropped in the redirect, so that the default
+// port is used.
+// It is a shortcut for RequireTLSProxies(redirect, nil).
+//
+//	router.Use(httprouter.RequireTLS(true))
+func RequireTLS(redirect bool) func(Handle) Handle {
+	return RequireTLSProxies(redirect, nil)
+}
+
+// RequireTLSProxies is like RequireTLS, but trusts the X-Forwarded-Proto
+// header of requests from the given proxies, e.g. a load balancer terminating
+// TLS, which are given as addresses or networks in CIDR notation like for
+// IPFilter. The header of requests from other addresses is ignored, so that
+// clients can not pretend a secure connection.
+// RequireTLSProxies panics if an entry can not be parsed.
+func RequireTLSProxies(redirect bool, proxies []string) func(Handle) Handle {
+	proxyNets := parseIPNets(proxies)
+
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			if isTLS(req, proxyNets) {
+				next(w, req, ps)
+				return
+			}
+			if !redirect {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			host := req.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+				if strings.IndexByte(host, ':') >= 0 {
+					host = "[" + host + "]"
+				}
+			}
+			uri := req.RequestURI
+			if uri == "" || uri[0] != '/' {
+				uri = req.URL.RequestURI()
+			}
+			http.Redirect(w, req, "https://"+host+uri, http.StatusPermanentRedirect)
+		}
+	}
+}
+
+// isTLS reports whether the request was received over TLS, either directly or
+// by a trusted proxy.
+func isTLS(req *http.Request, proxies []*net.IPNet) bool {
+	if req.TLS != nil {
+		return true
+	}
+	if len(proxies) == 0 {
+		return false
+	}
+	proto := req.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		return false
+	}
+	ip := parseIP(req.RemoteAddr)
+	if ip == nil || !containsIP(proxies, ip) {
+		return false
+	}
+
+	// The last value was set by the nearest proxy
+	if i := strings.LastIndexByte(proto, ','); i >= 0 {
+		proto = proto[i+1:]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
@@ -0,0 +1,88 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireTLS(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	redirecting := New()
+	redirecting.POST("/pay", handle)
+	redirecting.Use(RequireTLS(true))
+	rejecting := New()
+	rejecting.POST("/pay", handle)
+	rejecting.Use(RequireTLS(false))
+
+	tests := []struct {
+		router   *Router
+		host     string
+		route    string
+		tls      bool
+		code     int
+		location string
+	}{
+		{redirecting, "example.com", "/pay?id=1", false, http.StatusPermanentRedirect, "https://example.com/pay?id=1"},
+		{redirecting, "example.com:8080", "/pay", false, http.StatusPermanentRedirect, "https://example.com/pay"},
+		{redirecting, "[::1]:8080", "/pay", false, http.StatusPermanentRedirect, "https://[::1]/pay"},
+		{redirecting, "example.com", "/pay", true, http.StatusOK, ""},
+		{rejecting, "example.com", "/pay", false, http.StatusForbidden, ""},
+		{rejecting, "example.com", "/pay", true, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.route, nil)
+		r.Host = test.host
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		test.router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s%s (tls=%v): want status %d, got %d", test.host, test.route, test.tls, test.code, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("%s%s: want Location %q, got %q", test.host, test.route, test.location, location)
+		}
+	}
+}
+
+func TestRequireTLSProxies(t *testing.T) {
+	router := New()
+	router.GET("/", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(RequireTLSProxies(false, []string{"10.0.0.0/8"}))
+
+	tests := []struct {
+		remoteAddr string
+		proto      string
+		code       int
+	}{
+		{"10.0.0.1:80", "https", http.StatusOK},
+		{"10.0.0.1:80", "HTTPS", http.StatusOK},
+		{"10.0.0.1:80", "http, https", http.StatusOK},
+		{"10.0.0.1:80", "https, http", http.StatusForbidden},
+		{"10.0.0.1:80", "http", http.StatusForbidden},
+		{"10.0.0.1:80", "", http.StatusForbidden},
+		// the header of untrusted clients is ignored
+		{"203.0.113.9:80", "https", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("RemoteAddr %q, X-Forwarded-Proto %q: want status %d, got %d",
+				test.remoteAddr, test.proto, test.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+// TraceResult is the outcome of a TraceStep.
+type TraceResult uint8
+
+const (
+	// The static path of the node matched the start of the remaining path.
+	TraceStatic TraceResult = iota
+	// The static path of the node did not match the remaining path.
+	TraceStaticMismatch
+	// The param node captured the segment.
+	TraceParam
+	// The param node rejected the segment, because it is empty, exceeds the
+	// length limit or does not have the arity of the param.
+	TraceParamRejected
+	// The catch-all node captured the rest of the path.
+	TraceCatchAll
+	// The path continues, but the node has no child for it.
+	TraceDeadEnd
+	// The path ended at the node, but no handle is registered for it.
+	TraceNoHandle
+	// The path ended at the node and its handle matched.
+	TraceMatch
+	// No handle matched, but one exists for the path with (without) a
+	// trailing slash, to which the request may be redirected.
+	TraceTSR
+)
+
+func (tr TraceResult) String() string {
+	switch tr {
+	case TraceStatic:
+		return "static"
+	case TraceStaticMismatch:
+		return "static mismatch"
+	case TraceParam:
+		return "param captured"
+	case TraceParamRejected:
+		return "param rejected"
+	case TraceCatchAll:
+		return "catch-all captured"
+	case TraceDeadEnd:
+		return "dead end"
+	case TraceNoHandle:
+		return "no handle"
+	case TraceMatch:
+		return "match"
+	case TraceTSR:
+		return "trailing slash redirect"
+	}
+	return "unknown"
+}
+
+// TraceStep is a step of the route lookup, see Router.Trace.
+type TraceStep struct {
+	// The path of the visited tree node, e.g. "/user/" or ":name"
+	Node string
+
+	// The remaining request path when the node was visited
+	Path string
+
+	// The value captured by a param or catch-all node
+	Value string
+
+	Result TraceResult
+}
+
+// Trace walks the tree of the given method like a request for the path would
+// and returns the visited nodes, e.g. for debugging why a path does not match
+// a route. The last step tells where and why the lookup ended.
+// Routes registered with Any and prefixes are not considered. If no route is
+// registered for the method, nil is returned.
+// Trace is a debugging tool and is not optimized for speed.
+func (r *Router) Trace(method, path string) []TraceStep {
+	root := r.trees[method]
+	if root == nil {
+		return nil
+	}
+	steps := root.trace(path, r.flags())
+	if last := steps[len(steps)-1]; last.Result != TraceMatch {
+		if _, _, tsr := root.lookup(path, nil, r.flags()); tsr {
+			steps = append(steps, TraceStep{Path: toggleTrailingSlash(path), Result: TraceTSR})
+		}
+	}
+	return steps
+}
+
+// trace walks the tree like lookup, recording the visited nodes.
+func (n *node) trace(path string, flags lookupFlags) []TraceStep {
+	var steps []TraceStep
+	step := func(result TraceResult, value string) {
+		steps = append(steps, TraceStep{Node: n.path, Path: path, Value: value, Result: result})
+	}
+
+	for {
+		switch n.nType {
+		case param:
+			end := 0
+			for end < len(path) && path[end] != '/' {
+				end++
+			}
+			if n.rejects(path[:end], flags) {
+				step(TraceParamRejected, path[:end])
+				return steps
+			}
+			step(TraceParam, path[:end])
+			path = path[end:]
+
+		case catchAll:
+			// Skip the empty node holding the catch-all
+			if len(n.children) > 0 {
+				n = n.children[0]
+				continue
+			}
+			step(TraceCatchAll, path)
+			if n.handle == nil {
+				step(TraceNoHandle, "")
+			} else {
+				step(TraceMatch, "")
+			}
+			return steps
+
+		default:
+			if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+				step(TraceStaticMismatch, "")
+				return steps
+			}
+			step(TraceStatic, "")
+			path = path[len(n.path):]
+		}
+
+		if path == "" {
+			if n.handle == nil {
+				step(TraceNoHandle, "")
+			} else {
+				step(TraceMatch, "")
+			}
+			return steps
+		}
+
+		// Descend into the child for the rest of the path. Static children
+		// take precedence over a param child, see lookupRec.
+		if n.wildChild && len(n.children) > 1 {
+			for i, c := range []byte(n.indices) {
+				if c == path[0] {
+					if sub := n.children[i].trace(path, flags); sub[len(sub)-1].Result == TraceMatch {
+						return append(steps, sub...)
+					}
+					break
+				}
+			}
+		}
+		switch {
+		case n.wildChild:
+			n = n.children[len(n.children)-1]
+		case n.nType == param && len(n.children) > 0:
+			n = n.children[0]
+		default:
+			next := -1
+			for i, c := range []byte(n.indices) {
+				if c == path[0] {
+					next = i
+					break
+				}
+			}
+			if next < 0 || n.nType == param {
+				step(TraceDeadEnd, "")
+				return steps
+			}
+			n = n.children[next]
+		}
+	}
+}
+
+// LookupResult is the result of Router.LookupDetailed.
+type LookupResult struct {
+	// The handle and the path parameter values, if the path was found
+	Handle Handle
+	Params Params
+
+	// Whether a redirection to the path with (without) the trailing slash
+	// should be performed, see Lookup
+	TSR bool
+
+	// Number of tree nodes the path matched before the lookup ended
+	Depth int
+
+	// The longest prefix of a registered route the path matched, e.g.
+	// /user/:name for /user/gopher/xyz if only /user/:name is registered.
+	// It may end within a static part of a route, e.g. /users/l for
+	// /users/lst if /users/list is registered.
+	MatchedPrefix string
+
+	// The rest of the path after the matched prefix, e.g. /xyz
+	Rest string
+}
+
+// LookupDetailed is like Lookup, but also reports how far the lookup got in
+// the tree, e.g. to find near misses caused by typos in route registrations.
+// Like Trace, it walks the tree again if the path is not found and is not
+// optimized for speed.
+func (r *Router) LookupDetailed(method, path string) LookupResult {
+	var res LookupResult
+	res.Handle, res.Params, res.TSR = r.Lookup(method, path)
+
+	root := r.trees[method]
+	if root == nil {
+		res.Rest = path
+		return res
+	}
+	for _, step := range root.trace(path, 0) {
+		switch step.Result {
+		case TraceStatic, TraceParam, TraceCatchAll:
+			res.Depth++
+			res.MatchedPrefix += step.Node
+		case TraceMatch, TraceNoHandle:
+			res.Rest = ""
+		case TraceStaticMismatch:
+			// The node may still match the start of the rest
+			i := longestCommonPrefix(step.Node, step.Path)
+			res.MatchedPrefix += step.Path[:i]
+			res.Rest = step.Path[i:]
+		default:
+			res.Rest = step.Path
+		}
+	}
+	return res
+}
@@ -0,0 +1,144 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouterTrace(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/users", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/user/:name/posts", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+	router.GET("/orders/:id{max=3}", handlerFunc)
+
+	tests := []struct {
+		path  string
+		steps []TraceStep
+	}{
+		{"/user/gopher/posts", []TraceStep{
+			{"/", "/user/gopher/posts", "", TraceStatic},
+			{"user", "user/gopher/posts", "", TraceStatic},
+			{"/", "/gopher/posts", "", TraceStatic},
+			{":name", "gopher/posts", "gopher", TraceParam},
+			{"/posts", "/posts", "", TraceStatic},
+			{"/posts", "", "", TraceMatch},
+		}},
+		// near miss: the last segment is misspelled
+		{"/user/gopher/post", []TraceStep{
+			{"/", "/user/gopher/post", "", TraceStatic},
+			{"user", "user/gopher/post", "", TraceStatic},
+			{"/", "/gopher/post", "", TraceStatic},
+			{":name", "gopher/post", "gopher", TraceParam},
+			{"/posts", "/post", "", TraceStaticMismatch},
+		}},
+		{"/user/gopher/comments", []TraceStep{
+			{"/", "/user/gopher/comments", "", TraceStatic},
+			{"user", "user/gopher/comments", "", TraceStatic},
+			{"/", "/gopher/comments", "", TraceStatic},
+			{":name", "gopher/comments", "gopher", TraceParam},
+			{"/posts", "/comments", "", TraceStaticMismatch},
+		}},
+		// the empty segment is never passed to the param
+		{"/user/", []TraceStep{
+			{"/", "/user/", "", TraceStatic},
+			{"user", "user/", "", TraceStatic},
+			{"/", "/", "", TraceStatic},
+			{"/", "", "", TraceNoHandle},
+		}},
+		{"/orders/1234", []TraceStep{
+			{"/", "/orders/1234", "", TraceStatic},
+			{"orders/", "orders/1234", "", TraceStatic},
+			{":id", "1234", "1234", TraceParamRejected},
+		}},
+		{"/src/a/b.go", []TraceStep{
+			{"/", "/src/a/b.go", "", TraceStatic},
+			{"src", "src/a/b.go", "", TraceStatic},
+			{"/*filepath", "/a/b.go", "/a/b.go", TraceCatchAll},
+			{"/*filepath", "/a/b.go", "", TraceMatch},
+		}},
+		{"/users/", []TraceStep{
+			{"/", "/users/", "", TraceStatic},
+			{"user", "users/", "", TraceStatic},
+			{"s", "s/", "", TraceStatic},
+			{"s", "/", "", TraceDeadEnd},
+			{"", "/users", "", TraceTSR},
+		}},
+	}
+	for _, test := range tests {
+		if steps := router.Trace(http.MethodGet, test.path); !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("%s: wrong trace:\nwant %v\n got %v", test.path, test.steps, steps)
+		}
+	}
+
+	if steps := router.Trace(http.MethodPost, "/users"); steps != nil {
+		t.Errorf("want no trace for a method without routes, got %v", steps)
+	}
+}
+
+func TestRouterTraceGithubAPI(t *testing.T) {
+	router, reqs := loadGithubAPI(nil)
+	for _, r := range reqs {
+		for _, path := range []string{r.RequestURI, r.RequestURI + "x", r.RequestURI + "/"} {
+			leaf, _, _ := router.trees[r.Method].lookup(path, nil, 0)
+			steps := router.Trace(r.Method, path)
+			last := steps[len(steps)-1]
+			if last.Result == TraceTSR {
+				last = steps[len(steps)-2]
+			}
+			if (last.Result == TraceMatch) != (leaf != nil) {
+				t.Errorf("%s %s: trace ends with %s, but lookup found %v", r.Method, path, last.Result, leaf != nil)
+			}
+		}
+	}
+}
+
+func TestRouterLookupDetailed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/users/list", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	tests := []struct {
+		path   string
+		found  bool
+		prefix string
+		rest   string
+		depth  int
+	}{
+		{"/user/gopher/xyz", false, "/user/:name", "/xyz", 4},
+		{"/user/gopher", true, "/user/:name", "", 4},
+		{"/users/lst", false, "/users/l", "st", 2},
+		{"/src/a/b", true, "/src/*filepath", "", 3},
+		{"/other", false, "/", "other", 1},
+	}
+	for _, test := range tests {
+		res := router.LookupDetailed(http.MethodGet, test.path)
+		if (res.Handle != nil) != test.found || res.MatchedPrefix != test.prefix ||
+			res.Rest != test.rest || res.Depth != test.depth {
+			t.Errorf("%s: want found=%v prefix %q rest %q depth %d, got found=%v prefix %q rest %q depth %d",
+				test.path, test.found, test.prefix, test.rest, test.depth,
+				res.Handle != nil, res.MatchedPrefix, res.Rest, res.Depth)
+		}
+	}
+
+	res := router.LookupDetailed(http.MethodGet, "/user/gopher")
+	if want := (Params{{"name", "gopher"}}); !reflect.DeepEqual(res.Params, want) {
+		t.Errorf("want params %v, got %v", want, res.Params)
+	}
+
+	res = router.LookupDetailed(http.MethodPost, "/user/gopher")
+	if res.Handle != nil || res.Depth != 0 || res.Rest != "/user/gopher" {
+		t.Errorf("lookup for a method without routes: got %+v", res)
+	}
+}
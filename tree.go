@@ -5,7 +5,9 @@
 package httprouter
 
 import (
+	"bytes"
 	"net/url"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -39,9 +41,23 @@ func unhex(c byte) byte {
 	return 0
 }
 
-func pathUnescape(s string) (string, error) {
+// lookupFlags modify how a path is looked up in the tree.
+type lookupFlags uint8
+
+const (
+	// '+' in param values is decoded as a space, see Router.DecodePlusAsSpace
+	plusAsSpace lookupFlags = 1 << iota
+	// Params match empty path segments, see EmptySegmentMatch
+	emptyParams
+)
+
+// pathUnescape decodes percent-encoded bytes in s. If plusAsSpace is set, '+'
+// is decoded as a space, otherwise it is left as it is, as RFC 3986 requires
+// for paths.
+func pathUnescape(s string, plusAsSpace bool) (string, error) {
 	// Count %, check that they're well-formed.
 	n := 0
+	hasPlus := false
 	for i := 0; i < len(s); {
 		switch s[i] {
 		case '%':
@@ -55,13 +71,14 @@ func pathUnescape(s string) (string, error) {
 			}
 			i += 3
 		case '+':
+			hasPlus = true
 			i++
 		default:
 			i++
 		}
 	}
 
-	if n == 0 {
+	if n == 0 && !(plusAsSpace && hasPlus) {
 		return s, nil
 	}
 
@@ -73,6 +90,14 @@ func pathUnescape(s string) (string, error) {
 			t[j] = unhex(s[i+1])<<4 | unhex(s[i+2])
 			j++
 			i += 3
+		case '+':
+			if plusAsSpace {
+				t[j] = ' '
+			} else {
+				t[j] = '+'
+			}
+			j++
+			i++
 		default:
 			t[j] = s[i]
 			j++
@@ -123,6 +148,20 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 	return "", -1, false
 }
 
+// wildcards returns the params and catch-all params of the path in order,
+// e.g. [":id", "*filepath"] for /users/:id/files/*filepath.
+func wildcards(path string) []string {
+	var names []string
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return names
+		}
+		names = append(names, wildcard)
+		path = path[i+len(wildcard):]
+	}
+}
+
 func countParams(path string) uint16 {
 	var n uint
 	for i := range []byte(path) {
@@ -151,6 +190,81 @@ type node struct {
 	priority  uint32
 	children  []*node
 	handle    Handle
+	fullPath  string
+
+	// Maximum length of the raw path segment matched by a param node.
+	// 0 means unlimited.
+	maxLen int
+
+	// Number of comma separated values in the raw path segment matched by a
+	// param node. 0 means any number.
+	arity int
+}
+
+// rejects reports whether the param node does not match the raw path segment,
+// i.e. if it is empty and the flags don't allow empty params, exceeds the
+// length limit or has the wrong arity.
+func (n *node) rejects(segment string, flags lookupFlags) bool {
+	return (segment == "" && flags&emptyParams == 0) ||
+		(n.maxLen > 0 && len(segment) > n.maxLen) ||
+		(n.arity > 0 && strings.Count(segment, ",")+1 != n.arity)
+}
+
+func (t nodeType) String() string {
+	switch t {
+	case root:
+		return "root"
+	case param:
+		return "param"
+	case catchAll:
+		return "catchAll"
+	}
+	return "static"
+}
+
+// dump writes an indented rendering of the subtree to buf, one node per line.
+func (n *node) dump(buf *bytes.Buffer, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(strconv.Quote(n.path))
+	buf.WriteString(" <")
+	buf.WriteString(n.nType.String())
+	buf.WriteByte('>')
+	if n.handle != nil {
+		buf.WriteString(" [handle ")
+		buf.WriteString(n.fullPath)
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('\n')
+	for _, child := range n.children {
+		child.dump(buf, depth+1)
+	}
+}
+
+// wildcardNode returns the node of the given wildcard, e.g. ":id", within the
+// subtree of a registered path, or nil if the path has no such wildcard.
+func (n *node) wildcardNode(path, wildcard string) *node {
+walk:
+	for {
+		if n.nType == param && n.path == wildcard && strings.HasPrefix(path, wildcard) {
+			return n
+		}
+		if !strings.HasPrefix(path, n.path) || len(path) == len(n.path) {
+			return nil
+		}
+		path = path[len(n.path):]
+
+		if n.wildChild && (path[0] == ':' || n.indices == "") {
+			n = n.children[len(n.children)-1]
+			continue
+		}
+		for i, c := range []byte(n.indices) {
+			if c == path[0] {
+				n = n.children[i]
+				continue walk
+			}
+		}
+		return nil
+	}
 }
 
 // Increments priority of the given child and reorders if necessary
@@ -205,6 +319,7 @@ walk:
 				indices:   n.indices,
 				children:  n.children,
 				handle:    n.handle,
+				fullPath:  n.fullPath,
 				priority:  n.priority - 1,
 			}
 
@@ -213,6 +328,7 @@ walk:
 			n.indices = string([]byte{n.path[i]})
 			n.path = path[:i]
 			n.handle = nil
+			n.fullPath = ""
 			n.wildChild = false
 		}
 
@@ -221,26 +337,31 @@ walk:
 			path = path[i:]
 
 			if n.wildChild {
-				n = n.children[0]
-				n.priority++
+				wild := n.children[len(n.children)-1]
 
 				// Check if the wildcard matches
-				if len(path) >= len(n.path) && n.path == path[:len(n.path)] &&
+				if len(path) >= len(wild.path) && wild.path == path[:len(wild.path)] &&
 					// Adding a child to a catchAll is not possible
-					n.nType != catchAll &&
+					wild.nType != catchAll &&
 					// Check for longer wildcard, e.g. :name and :names
-					(len(n.path) >= len(path) || path[len(n.path)] == '/') {
+					(len(wild.path) >= len(path) || path[len(wild.path)] == '/') {
+					n = wild
+					n.priority++
 					continue walk
-				} else {
+				}
+
+				// A static segment may be added next to a param spanning a
+				// whole segment, see mixable
+				if wild.nType != param || path[0] == ':' || path[0] == '*' || !n.mixable() {
 					// Wildcard conflict
 					pathSeg := path
-					if n.nType != catchAll {
+					if wild.nType != catchAll {
 						pathSeg = strings.SplitN(pathSeg, "/", 2)[0]
 					}
-					prefix := fullPath[:strings.Index(fullPath, pathSeg)] + n.path
+					prefix := fullPath[:strings.Index(fullPath, pathSeg)] + wild.path
 					panic("'" + pathSeg +
 						"' in new path '" + fullPath +
-						"' conflicts with existing wildcard '" + n.path +
+						"' conflicts with existing wildcard '" + wild.path +
 						"' in existing prefix '" + prefix +
 						"'")
 				}
@@ -269,7 +390,13 @@ walk:
 				// []byte for proper unicode char conversion, see #65
 				n.indices += string([]byte{idxc})
 				child := &node{}
-				n.children = append(n.children, child)
+				if n.wildChild {
+					// Keep the wildcard child last
+					wild := n.children[len(n.children)-1]
+					n.children = append(n.children[:len(n.children)-1], child, wild)
+				} else {
+					n.children = append(n.children, child)
+				}
 				n.incrementChildPrio(len(n.indices) - 1)
 				n = child
 			}
@@ -282,6 +409,7 @@ walk:
 			panic("a handle is already registered for path '" + fullPath + "'")
 		}
 		n.handle = handle
+		n.fullPath = fullPath
 		return
 	}
 }
@@ -306,8 +434,9 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 		}
 
 		// Check if this node has existing children which would be
-		// unreachable if we insert the wildcard here
-		if len(n.children) > 0 {
+		// unreachable if we insert the wildcard here. Only a param spanning a
+		// whole segment can be added next to static children, see mixable.
+		if len(n.children) > 0 && (wildcard[0] != ':' || i > 0 || !n.mixable()) {
 			panic("wildcard segment '" + wildcard +
 				"' conflicts with existing children in path '" + fullPath + "'")
 		}
@@ -325,7 +454,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 				nType: param,
 				path:  wildcard,
 			}
-			n.children = []*node{child}
+			n.children = append(n.children, child)
 			n = child
 			n.priority++
 
@@ -343,6 +472,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			// Otherwise we're done. Insert the handle in the new leaf
 			n.handle = handle
+			n.fullPath = fullPath
 			return
 		}
 
@@ -378,6 +508,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 			path:     path[i:],
 			nType:    catchAll,
 			handle:   handle,
+			fullPath: fullPath,
 			priority: 1,
 		}
 		n.children = []*node{child}
@@ -388,6 +519,15 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 	// If no wildcard was found, simply insert the path and handle
 	n.path = path
 	n.handle = handle
+	n.fullPath = fullPath
+}
+
+// mixable reports whether static children and a param child can be added to
+// the node next to each other, which is the case if the param spans a whole
+// path segment, e.g. /user/new and /user/:name. The static children then take
+// precedence.
+func (n *node) mixable() bool {
+	return len(n.path) > 0 && n.path[len(n.path)-1] == '/'
 }
 
 // Returns the handle registered with the given path (key). The values of
@@ -396,11 +536,38 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) getValue(path string, params func() *Params) (handle Handle, ps *Params, tsr bool) {
+	leaf, ps, tsr := n.lookup(path, params, 0)
+	if leaf != nil {
+		handle = leaf.handle
+	}
+	return
+}
+
+// Like getValue, but returns the node holding the handle instead, which e.g.
+// also provides the full path of the matched route.
+// The flags modify how the path is matched, e.g. how param values are decoded.
+func (n *node) lookup(path string, params func() *Params, flags lookupFlags) (leaf *node, ps *Params, tsr bool) {
+	return n.lookupRec(path, params, nil, flags, false)
+}
+
+// Recursive lookup function used by n.lookup. Params are appended to the
+// params captured so far, which are allocated with params if needed.
+// Below a node with both static children and a param child, the static
+// children are walked first. If the path matches no route below them, the
+// node is walked again with skipStatic set, which descends into the param
+// child right away.
+func (n *node) lookupRec(path string, params func() *Params, captured *Params, flags lookupFlags, skipStatic bool) (leaf *node, ps *Params, tsr bool) {
+	ps = captured
+
+	// The node from which the current node was reached
+	var parent *node
+
 walk: // Outer loop for walking the tree
 	for {
 		prefix := n.path
 		if len(path) > len(prefix) {
 			if path[:len(prefix)] == prefix {
+				walked := path
 				path = path[len(prefix):]
 
 				// If this node does not have a wildcard (param or catchAll)
@@ -410,6 +577,7 @@ walk: // Outer loop for walking the tree
 					idxc := path[0]
 					for i, c := range []byte(n.indices) {
 						if c == idxc {
+							parent = n
 							n = n.children[i]
 							continue walk
 						}
@@ -422,8 +590,33 @@ walk: // Outer loop for walking the tree
 					return
 				}
 
+				// Static children take precedence over a param child
+				if len(n.children) > 1 && !skipStatic {
+					saved := 0
+					if ps != nil {
+						saved = len(*ps)
+					}
+					for i, c := range []byte(n.indices) {
+						if c == path[0] {
+							leaf, ps, tsr = n.children[i].lookupRec(path, params, ps, flags, false)
+							if leaf != nil {
+								return leaf, ps, false
+							}
+							break
+						}
+					}
+					if ps != nil {
+						*ps = (*ps)[:saved]
+					}
+
+					staticTSR := tsr
+					leaf, ps, tsr = n.lookupRec(walked, params, ps, flags, true)
+					return leaf, ps, leaf == nil && (tsr || staticTSR)
+				}
+				skipStatic = false
+
 				// Handle wildcard child
-				n = n.children[0]
+				n = n.children[len(n.children)-1]
 				switch n.nType {
 				case param:
 					// Find param end (either '/' or path end)
@@ -432,15 +625,22 @@ walk: // Outer loop for walking the tree
 						end++
 					}
 
-					// Save param value
-					if params != nil {
+					// An empty segment only matches a param if enabled by the
+					// flags, one exceeding the length limit or with the wrong
+					// arity never does
+					if n.rejects(path[:end], flags) {
+						return
+					}
+
+					// Save param value, unless the param is blank
+					if params != nil && n.path[1:] != blankParam {
 						if ps == nil {
 							ps = params()
 						}
 						// Expand slice within preallocated capacity
 						i := len(*ps)
 						*ps = (*ps)[:i+1]
-						value, _ := pathUnescape(path[:end])
+						value, _ := pathUnescape(path[:end], flags&plusAsSpace != 0)
 						(*ps)[i] = Param{
 							Key:   n.path[1:],
 							Value: value,
@@ -451,6 +651,7 @@ walk: // Outer loop for walking the tree
 					if end < len(path) {
 						if len(n.children) > 0 {
 							path = path[end:]
+							parent = n
 							n = n.children[0]
 							continue walk
 						}
@@ -460,7 +661,8 @@ walk: // Outer loop for walking the tree
 						return
 					}
 
-					if handle = n.handle; handle != nil {
+					if n.handle != nil {
+						leaf = n
 						return
 					} else if len(n.children) == 1 {
 						// No handle found. Check if a handle for this path + a
@@ -480,14 +682,16 @@ walk: // Outer loop for walking the tree
 						// Expand slice within preallocated capacity
 						i := len(*ps)
 						*ps = (*ps)[:i+1]
-						value, _ := pathUnescape(path)
+						value, _ := pathUnescape(path, flags&plusAsSpace != 0)
 						(*ps)[i] = Param{
 							Key:   n.path[2:],
 							Value: value,
 						}
 					}
 
-					handle = n.handle
+					if n.handle != nil {
+						leaf = n
+					}
 					return
 
 				default:
@@ -497,15 +701,16 @@ walk: // Outer loop for walking the tree
 		} else if path == prefix {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handle = n.handle; handle != nil {
+			if n.handle != nil {
+				leaf = n
 				return
 			}
 
 			// If there is no handle for this route, but this route has a
-			// wildcard child, there must be a handle for this path with an
-			// additional trailing slash
+			// wildcard child, a handle for this path without the trailing
+			// slash might exist
 			if path == "/" && n.wildChild && n.nType != root {
-				tsr = true
+				tsr = parent != nil && parent.handle != nil
 				return
 			}
 
@@ -667,7 +872,31 @@ walk: // Outer loop for walking the tree
 				return nil
 			}
 
-			n = n.children[0]
+			// Static children take precedence over a param child. Since the
+			// path of the node ends with '/', a new rune starts.
+			if len(n.children) > 1 {
+				rv, _ := utf8.DecodeRuneInString(path)
+				lo := unicode.ToLower(rv)
+				for j, r := range [2]rune{lo, unicode.ToUpper(rv)} {
+					if j > 0 && r == lo {
+						break
+					}
+					var rb [4]byte
+					utf8.EncodeRune(rb[:], r)
+					for i, c := range []byte(n.indices) {
+						if c == rb[0] {
+							if out := n.children[i].findCaseInsensitivePathRec(
+								path, ciPath, rb, fixTrailingSlash,
+							); out != nil {
+								return out
+							}
+							break
+						}
+					}
+				}
+			}
+
+			n = n.children[len(n.children)-1]
 			switch n.nType {
 			case param:
 				// Find param end (either '/' or path end)
@@ -676,6 +905,12 @@ walk: // Outer loop for walking the tree
 					end++
 				}
 
+				// An empty segment never matches a param, nor one exceeding
+				// the length limit or with the wrong arity
+				if n.rejects(path[:end], 0) {
+					return nil
+				}
+
 				// Add param value to case insensitive path
 				ciPath = append(ciPath, path[:end]...)
 
@@ -752,3 +987,31 @@ walk: // Outer loop for walking the tree
 	}
 	return nil
 }
+
+// walkPrefix calls fn for all nodes with a handle whose route path starts with
+// the prefix, in tree order. Only the subtree of the prefix is walked.
+func (n *node) walkPrefix(prefix string, fn func(*node)) {
+	if len(prefix) > len(n.path) {
+		if prefix[:len(n.path)] != n.path {
+			return
+		}
+		prefix = prefix[len(n.path):]
+		for _, child := range n.children {
+			child.walkPrefix(prefix, fn)
+		}
+		return
+	}
+	if n.path[:len(prefix)] == prefix {
+		n.walk(fn)
+	}
+}
+
+// walk calls fn for all nodes with a handle in the subtree of n.
+func (n *node) walk(fn func(*node)) {
+	if n.handle != nil {
+		fn(n)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
@@ -186,6 +186,64 @@ func TestTreeWildcard(t *testing.T) {
 	checkPriorities(t, tree)
 }
 
+func TestTreeStaticAndParam(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/:lang/home",
+		"/admin/home",
+		"/admin/users/:id",
+		"/:lang/about/",
+		"/users/:name",
+		"/users/new",
+		"/users/:name/posts",
+		"/users/newest/posts",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	// printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/en/home", false, "/:lang/home", Params{Param{"lang", "en"}}},
+		{"/admin/home", false, "/admin/home", nil},
+		{"/admin/users/1", false, "/admin/users/:id", Params{Param{"id", "1"}}},
+		{"/admin/about/", false, "/:lang/about/", Params{Param{"lang", "admin"}}}, // falls back to the param
+		{"/adm/home", false, "/:lang/home", Params{Param{"lang", "adm"}}},
+		{"/users/new", false, "/users/new", nil},
+		{"/users/gopher", false, "/users/:name", Params{Param{"name", "gopher"}}},
+		{"/users/new/posts", false, "/users/:name/posts", Params{Param{"name", "new"}}},
+		{"/users/newest", false, "/users/:name", Params{Param{"name", "newest"}}},
+		{"/users/newest/posts", false, "/users/newest/posts", nil},
+		{"/admin/users", true, "", Params{Param{"lang", "admin"}}},
+	})
+
+	checkPriorities(t, tree)
+
+	for path, tsr := range map[string]bool{
+		"/en/about":   true,
+		"/users/new/": true,
+		"/en/home/x":  false,
+	} {
+		if _, _, got := tree.getValue(path, nil); got != tsr {
+			t.Errorf("wrong TSR recommendation for %q: want %t", path, tsr)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"/ADMIN/HOME":  "/admin/home",
+		"/EN/HOME":     "/EN/home",
+		"/USERS/NEW":   "/users/new",
+		"/ADMIN/ABOUT": "/ADMIN/about/",
+	} {
+		out, found := tree.findCaseInsensitivePath(in, true)
+		if !found || string(out) != want {
+			t.Errorf("wrong case insensitive lookup for %q: want %q, got %q (found=%t)", in, want, out, found)
+		}
+	}
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -224,7 +282,7 @@ func testRoutes(t *testing.T, routes []testRoute) {
 func TestTreeWildcardConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/:tool/:sub", false},
-		{"/cmd/vet", true},
+		{"/cmd/vet", false},
 		{"/src/*filepath", false},
 		{"/src/*filepathx", true},
 		{"/src/", true},
@@ -232,7 +290,7 @@ func TestTreeWildcardConflict(t *testing.T) {
 		{"/src1/*filepath", true},
 		{"/src2*filepath", true},
 		{"/search/:query", false},
-		{"/search/invalid", true},
+		{"/search/invalid", false},
 		{"/user_:name", false},
 		{"/user_x", true},
 		{"/user_:name", false},
@@ -245,14 +303,14 @@ func TestTreeWildcardConflict(t *testing.T) {
 func TestTreeChildConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/vet", false},
-		{"/cmd/:tool/:sub", true},
+		{"/cmd/:tool/:sub", false},
 		{"/src/AUTHORS", false},
 		{"/src/*filepath", true},
 		{"/user_x", false},
 		{"/user_:name", true},
 		{"/id/:id", false},
 		{"/id:id", true},
-		{"/:id", true},
+		{"/:id", false},
 		{"/*filepath", true},
 	}
 	testRoutes(t, routes)